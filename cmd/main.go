@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+
 	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
 	"github.com/sounishnath003/url-shortner-service-golang/internal/server"
 )
 
 func main() {
 	co := core.InitCore()
+	// Flush the pending spans, deferred calls still run on panic.
+	defer co.ShutdownTracing(context.Background())
 
 	server := server.NewServer(co)
 	panic(server.Run())
@@ -1,4 +1,7 @@
+DROP TABLE IF EXISTS url_daily_stats;
+DROP TABLE IF EXISTS urls_hit_count;
 DROP TABLE IF EXISTS users_url_mappings;
+DROP TABLE IF EXISTS idempotency_keys;
 DROP TABLE IF EXISTS users;
 DROP TABLE IF EXISTS url_mappings;
 
@@ -20,8 +23,10 @@ CREATE TABLE IF NOT EXISTS url_mappings (
 	id INT PRIMARY KEY GENERATED BY DEFAULT AS Identity,
     user_id INT NOT NULL,
 	original_url VARCHAR(255) NOT NULL,
-	short_url VARCHAR(20) NOT NULL UNIQUE,
-    hit_count INT DEFAULT 0;
+	short_url VARCHAR(20) UNIQUE, -- NULL once the alias has been reclaimed
+	reclaimed_short_url VARCHAR(20), -- alias of the expired short url, before its reclaim
+    hit_count INT DEFAULT 0,
+    bot_hit_count INT DEFAULT 0,
 	expiration_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -29,6 +34,7 @@ CREATE TABLE IF NOT EXISTS url_mappings (
 
 CREATE INDEX IF NOT EXISTS url_mappings_short_url_idx ON url_mappings (short_url);
 CREATE INDEX IF NOT EXISTS url_mappings_user_id_idx ON url_mappings (user_id);
+CREATE INDEX IF NOT EXISTS url_mappings_expiration_at_idx ON url_mappings (expiration_at);
 
 -- user_url_mappings
 CREATE TABLE IF NOT EXISTS users_url_mappings (
@@ -60,25 +66,70 @@ INSERT INTO users_url_mappings (UrlID, UserID) VALUES (5, 1);
 INSERT INTO users_url_mappings (UrlID, UserID) VALUES (6, 1);
 INSERT INTO users_url_mappings (UrlID, UserID) VALUES (7, 1);
 
--- Url hits count
+-- Url hits count (one row per redirect)
 CREATE TABLE IF NOT EXISTS urls_hit_count (
-    url_id INT PRIMARY KEY,
+    id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS Identity,
+    url_id INT NOT NULL,
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    country VARCHAR(8),
+    referrer VARCHAR(255),
+    device VARCHAR(16),
     hit_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (url_id) REFERENCES url_mappings(id) ON DELETE CASCADE
 );
 
-CREATE INDEX IF NOT EXISTS urls_hit_count_url_id_idx ON urls_hit_count (url_id);
+CREATE INDEX IF NOT EXISTS urls_hit_count_url_id_idx ON urls_hit_count (url_id, hit_at);
+CREATE INDEX IF NOT EXISTS urls_hit_count_hit_at_idx ON urls_hit_count (hit_at);
+
+-- Url daily stats (rollups of urls_hit_count, days in UTC)
+CREATE TABLE IF NOT EXISTS url_daily_stats (
+    url_id INT NOT NULL,
+    day DATE NOT NULL,
+    hits INT NOT NULL DEFAULT 0,
+    bot_hits INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day),
+    FOREIGN KEY (url_id) REFERENCES url_mappings(id) ON DELETE CASCADE
+);
+
+-- The rollup resumes from the last day rolled up.
+CREATE INDEX IF NOT EXISTS url_daily_stats_day_idx ON url_daily_stats (day);
 
 
 
+-- Idempotency keys of the shorten requests, with the response to replay
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status INT,
+    response TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, idempotency_key),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
 -- Generate a incremental id generator
-CREATE UNLOGGED SEQUENCE IF NOT EXISTS public.incr_id_generator_seq
-    INCREMENT 1
+-- Up to the 2^40 - 1 ids of the default SHORTCODE_ID_BITS (40), raise it along with the bits.
+CREATE SEQUENCE IF NOT EXISTS public.incr_id_generator_seq
+    AS BIGINT
+    INCREMENT 1000
     START 1000000
-    MAXVALUE 999999999;
+    MAXVALUE 1099511627775;
 
 ALTER SEQUENCE public.incr_id_generator_seq
     OWNER TO root;
 
+-- An unlogged sequence is reset after a crash, and would lease the same ids again.
+ALTER SEQUENCE public.incr_id_generator_seq
+    SET LOGGED;
+
+-- Every nextval leases a block of 1000 ids to a replica.
+ALTER SEQUENCE public.incr_id_generator_seq
+    AS BIGINT
+    INCREMENT BY 1000
+    MAXVALUE 1099511627775;
+
 COMMENT ON SEQUENCE public.incr_id_generator_seq
-    IS 'to generate the incremental id for short urls';
\ No newline at end of file
+    IS 'to lease the blocks of incremental ids for short urls';
\ No newline at end of file
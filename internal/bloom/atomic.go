@@ -0,0 +1,65 @@
+package bloom
+
+import "sync/atomic"
+
+// Atomic is a Filter which can be swapped for another one at runtime, e.g.
+// once rebuilt, without stopping the lookups.
+type Atomic struct {
+	filter atomic.Pointer[Filter]
+}
+
+// NewAtomic helps to create a new swappable filter, initially using filter.
+func NewAtomic(filter Filter) *Atomic {
+	a := &Atomic{}
+	a.Swap(filter)
+	return a
+}
+
+// Load returns the filter currently used.
+func (a *Atomic) Load() Filter {
+	return *a.filter.Load()
+}
+
+// Swap replaces the filter currently used.
+func (a *Atomic) Swap(filter Filter) {
+	a.filter.Store(&filter)
+}
+
+func (a *Atomic) Add(key string) {
+	a.Load().Add(key)
+}
+
+func (a *Atomic) AddMany(keys []string) {
+	AddMany(a.Load(), keys)
+}
+
+func (a *Atomic) Exists(key string) bool {
+	return a.Load().Exists(key)
+}
+
+// Remove helps to remove the key, when the filter currently used supports it.
+func (a *Atomic) Remove(key string) {
+	if filter, deletable := a.Load().(DeletableFilter); deletable {
+		filter.Remove(key)
+	}
+}
+
+func (a *Atomic) Info() map[string]any {
+	return a.Load().Info()
+}
+
+func (a *Atomic) FillRatio() float64 {
+	return a.Load().FillRatio()
+}
+
+func (a *Atomic) EstimatedFalsePositiveRate() float64 {
+	return a.Load().EstimatedFalsePositiveRate()
+}
+
+func (a *Atomic) MarshalBinary() ([]byte, error) {
+	return a.Load().MarshalBinary()
+}
+
+func (a *Atomic) UnmarshalBinary(data []byte) error {
+	return a.Load().UnmarshalBinary(data)
+}
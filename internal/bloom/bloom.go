@@ -1,91 +1,140 @@
 package bloom
 
 import (
-	"sync"
-
-	"github.com/spaolacci/murmur3"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sync/atomic"
 )
 
+// BloomFilter is a bit-packed bloom filter, safe for concurrent use.
+//
+// The bits are stored 64 per word and set with atomic operations, and the
+// indexes are derived from a single stateless murmur3 hash of the key (double
+// hashing), so neither Add nor Exists takes any lock.
 type BloomFilter struct {
-	Store    []bool            // to Store Bitset
-	Size     int32             // Size of the filters
-	mHashers []murmur3.Hash128 // HashFunctions to improve the probabilistic accuracy
+	bits          []uint64 // bitset, 64 bits per word
+	size          uint64   // number of bits of the filter
+	hashFuncs     uint64   // number of indexes set per key
+	expectedItems uint64
+	targetFpp     float64
 
-	mu sync.Mutex
+	setBits atomic.Int64 // Number of bits set in the bitset
 }
 
-// NewBloomFilter helps to create a new bloom.Filter with the given size.
-//
-// It initializes the bloom.Store with the size and generates the
-// murmur3 hash functions with different seeds.
+// NewBloomFilter helps to create a new bloom.Filter sized for the expected
+// number of items, with the target false positive rate once they are added.
 //
-// The number of hash functions is fixed to 8.
+// The optimal size is m = -n * ln(p) / ln(2)^2 bits,
+// with k = m / n * ln(2) hash functions.
 //
 // Returns a new bloom.Filter.
-func NewBloomFilter(size int32) *BloomFilter {
-	// Generating the Seed and MHashers (Murmur 128 style)
-	//
+func NewBloomFilter(expectedItems uint64, falsePositiveRate float64) *BloomFilter {
+	n, p, size, hashFuncs := optimalSize(expectedItems, falsePositiveRate)
+
 	return &BloomFilter{
-		Store: make([]bool, size),
-		Size:  size,
-		mHashers: []murmur3.Hash128{
-			murmur3.New128WithSeed(uint32(11)),
-			murmur3.New128WithSeed(uint32(31)),
-			murmur3.New128WithSeed(uint32(131)),
-			murmur3.New128WithSeed(uint32(989)),
-			murmur3.New128WithSeed(uint32(1919)),
-			murmur3.New128WithSeed(uint32(2007)),
-			murmur3.New128WithSeed(uint32(31313)),
-			murmur3.New128WithSeed(uint32(9281917)),
-		},
+		bits:          make([]uint64, (size+63)/64),
+		size:          size,
+		hashFuncs:     hashFuncs,
+		expectedItems: n,
+		targetFpp:     p,
 	}
 }
 
 // Info returns the required information for the bloom.Filter configuration
 func (bf *BloomFilter) Info() map[string]any {
 	return map[string]any{
-		"size":           bf.Size,
-		"totalHashFuncs": len(bf.mHashers),
+		"type":           FilterStandard,
+		"size":           bf.size,
+		"bytes":          len(bf.bits) * 8,
+		"totalHashFuncs": bf.hashFuncs,
+		"expectedItems":  bf.expectedItems,
+		"targetFpp":      bf.targetFpp,
+		"fillRatio":      bf.FillRatio(),
+		"estimatedFpp":   bf.EstimatedFalsePositiveRate(),
 	}
 }
 
-// ComputeMurmurHash computes and returns the murmur has of a query string `key`
-// you have to module it with the bloom.Size to set the index True in bloom.Store
-//
-// Non-cryptographic hash, fast and efficient and implementation specific.
-func (bf *BloomFilter) ComputeMurmurHash(key string, hashFn int) uint64 {
-	bf.mHashers[hashFn].Write([]byte(key))
-	val, _ := bf.mHashers[hashFn].Sum128()
-	bf.mHashers[hashFn].Reset()
-	return val
+// FillRatio returns the ratio of the bits set in the bitset.
+func (bf *BloomFilter) FillRatio() float64 {
+	return float64(bf.setBits.Load()) / float64(bf.size)
+}
+
+// EstimatedFalsePositiveRate returns the current probability of a false positive.
+// Every hash function has to land on a set bit, which gives fillRatio ^ totalHashFuncs.
+func (bf *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(bf.FillRatio(), float64(bf.hashFuncs))
 }
 
-// Add helps to add add given key into the bloom.Store. Remember it does not store the
+// Add helps to add add given key into the bitset. Remember it does not store the
 // actual keys. rather it a probabilistic representtal of their presence.
 func (bf *BloomFilter) Add(key string) {
-	// index := bf.ComputeMurmurHash(key) % uint64(bf.Size)
-	// bf.Store[index] = true
-	// Utilizing all has functions
-	bf.mu.Lock()
-	for i := 0; i < len(bf.mHashers); i++ {
-		index := bf.ComputeMurmurHash(key, i) % uint64(bf.Size)
-		bf.Store[index] = true
-	}
-	bf.mu.Unlock()
+	indexes(key, bf.size, bf.hashFuncs, func(index uint64) bool {
+		mask := uint64(1) << (index % 64)
+		if atomic.OrUint64(&bf.bits[index/64], mask)&mask == 0 {
+			bf.setBits.Add(1)
+		}
+		return true
+	})
 }
 
-// Exists helps to lookup if the key present in the bloom.Store.
+// Exists helps to lookup if the key present in the bitset.
 // In real, the key might not be present even if the return is true. as it
 // works as a probabilistic estimation of finding the presence.
-func (bf *BloomFilter) Exists(key string) (uint64, bool) {
-	// index := bf.ComputeMurmurHash(key) % uint64(bf.Size)
-	// return index, bf.Store[index]
-
-	for i := 0; i < len(bf.mHashers); i++ {
-		index := bf.ComputeMurmurHash(key, i) % uint64(bf.Size)
-		if !bf.Store[index] {
-			return index, false
-		}
+func (bf *BloomFilter) Exists(key string) bool {
+	exists := true
+	indexes(key, bf.size, bf.hashFuncs, func(index uint64) bool {
+		mask := uint64(1) << (index % 64)
+		exists = atomic.LoadUint64(&bf.bits[index/64])&mask != 0
+		return exists
+	})
+	return exists
+}
+
+// snapshotMagic prefixes the bloom.Filter snapshots, versioning their encoding.
+var snapshotMagic = []byte("BLM2")
+
+// snapshotHeader is the magic followed by the size and the number of hash functions.
+var snapshotHeader = len(snapshotMagic) + 16
+
+// ErrSnapshotMismatch is returned when the snapshot does not fit the bloom.Filter configuration.
+var ErrSnapshotMismatch = errors.New("bloom filter snapshot does not match the filter configuration")
+
+// MarshalBinary encodes the bitset into a snapshot.
+// Implements the encoding.BinaryMarshaler.
+//
+// The keys added concurrently may or may not be part of the snapshot.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, snapshotHeader+len(bf.bits)*8)
+	copy(data, snapshotMagic)
+	binary.BigEndian.PutUint64(data[len(snapshotMagic):], bf.size)
+	binary.BigEndian.PutUint64(data[len(snapshotMagic)+8:], bf.hashFuncs)
+
+	for i := range bf.bits {
+		binary.BigEndian.PutUint64(data[snapshotHeader+i*8:], atomic.LoadUint64(&bf.bits[i]))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary merges a snapshot taken by MarshalBinary into the bitset.
+// The snapshot must have been taken from a bloom.Filter of the same configuration.
+// Implements the encoding.BinaryUnmarshaler.
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < snapshotHeader || string(data[:len(snapshotMagic)]) != string(snapshotMagic) {
+		return errors.New("invalid bloom filter snapshot")
+	}
+	size := binary.BigEndian.Uint64(data[len(snapshotMagic):])
+	hashFuncs := binary.BigEndian.Uint64(data[len(snapshotMagic)+8:])
+	if size != bf.size || hashFuncs != bf.hashFuncs || len(data)-snapshotHeader != len(bf.bits)*8 {
+		return ErrSnapshotMismatch
+	}
+
+	for i := range bf.bits {
+		// Merge with the keys added in the meantime.
+		word := binary.BigEndian.Uint64(data[snapshotHeader+i*8:])
+		old := atomic.OrUint64(&bf.bits[i], word)
+		bf.setBits.Add(int64(bits.OnesCount64(word &^ old)))
 	}
-	return 0, true
+	return nil
 }
@@ -0,0 +1,206 @@
+package bloom
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// keys returns count distinct keys with the prefix.
+func keys(prefix string, count int) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return keys
+}
+
+// assertAllExist fails the test for every key reported missing.
+func assertAllExist(t *testing.T, filter Filter, keys []string) {
+	t.Helper()
+	for _, key := range keys {
+		if !filter.Exists(key) {
+			t.Errorf("key %q was added but is reported missing", key)
+			return
+		}
+	}
+}
+
+// newFilters returns one filter of every kind, sized for expectedItems.
+// The scalable filter chains a few stages when more keys are added.
+func newFilters(expectedItems uint64) map[string]Filter {
+	return map[string]Filter{
+		FilterStandard: NewBloomFilter(expectedItems, 0.01),
+		FilterCounting: NewCountingBloomFilter(expectedItems, 0.01),
+		"scalable":     NewScalableBloomFilter(FilterStandard, expectedItems/8, 0.01),
+	}
+}
+
+// TestConcurrentAddExists checks a key is reported present as soon as added,
+// while other goroutines keep adding and looking up keys.
+func TestConcurrentAddExists(t *testing.T) {
+	const workers, perWorker = 8, 2000
+
+	for name, filter := range newFilters(workers * perWorker) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for w := range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for _, key := range keys(fmt.Sprintf("worker%d", w), perWorker) {
+						filter.Add(key)
+						if !filter.Exists(key) {
+							t.Errorf("key %q is reported missing right after being added", key)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			for w := range workers {
+				assertAllExist(t, filter, keys(fmt.Sprintf("worker%d", w), perWorker))
+			}
+		})
+	}
+}
+
+// TestConcurrentAddMany checks the batched adds, concurrent with the lookups.
+func TestConcurrentAddMany(t *testing.T) {
+	const workers, perWorker = 8, 2000
+
+	for name, filter := range newFilters(workers * perWorker) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for w := range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					batch := keys(fmt.Sprintf("batch%d", w), perWorker)
+					AddMany(filter, batch)
+					assertAllExist(t, filter, batch)
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// TestCountingConcurrentRemove checks removing keys never makes the other
+// keys missing, while keys are added and removed concurrently.
+func TestCountingConcurrentRemove(t *testing.T) {
+	const workers, perWorker = 8, 2000
+
+	filter := NewCountingBloomFilter(2*workers*perWorker, 0.01)
+	kept := keys("kept", workers*perWorker)
+	for _, key := range kept {
+		filter.Add(key)
+	}
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(2)
+		// Churn: every worker only removes the keys it added.
+		go func() {
+			defer wg.Done()
+			for _, key := range keys(fmt.Sprintf("churn%d", w), perWorker) {
+				filter.Add(key)
+				filter.Remove(key)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			assertAllExist(t, filter, kept)
+		}()
+	}
+	wg.Wait()
+
+	assertAllExist(t, filter, kept)
+}
+
+// TestConcurrentUnmarshal checks the keys of a snapshot stay present while
+// the snapshot gets restored, concurrently with the lookups and the adds.
+func TestConcurrentUnmarshal(t *testing.T) {
+	const workers, perWorker = 4, 2000
+
+	snapshotted := keys("snapshotted", workers*perWorker)
+	for name, filter := range newFilters(2 * workers * perWorker) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range snapshotted {
+				filter.Add(key)
+			}
+			data, err := filter.MarshalBinary()
+			if err != nil {
+				t.Fatalf("unable to marshal the filter: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for w := range workers {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					if err := filter.UnmarshalBinary(data); err != nil {
+						t.Errorf("unable to unmarshal the filter: %v", err)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					assertAllExist(t, filter, snapshotted)
+					for _, key := range keys(fmt.Sprintf("lookup%d", w), perWorker) {
+						filter.Exists(key)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assertAllExist(t, filter, snapshotted)
+		})
+	}
+}
+
+// TestSnapshotRoundTrip checks a restored filter holds every key of the snapshot.
+func TestSnapshotRoundTrip(t *testing.T) {
+	added := keys("added", 5000)
+	for name, filter := range newFilters(10000) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range added {
+				filter.Add(key)
+			}
+			data, err := filter.MarshalBinary()
+			if err != nil {
+				t.Fatalf("unable to marshal the filter: %v", err)
+			}
+
+			restored := newFilters(10000)[name]
+			if err := restored.UnmarshalBinary(data); err != nil {
+				t.Fatalf("unable to unmarshal the filter: %v", err)
+			}
+			assertAllExist(t, restored, added)
+		})
+	}
+}
+
+// TestFalsePositiveRate checks the false positive rate stays close to the target.
+func TestFalsePositiveRate(t *testing.T) {
+	const items = 20000
+
+	for name, filter := range newFilters(items) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range keys("member", items) {
+				filter.Add(key)
+			}
+
+			falsePositives := 0
+			for _, key := range keys("stranger", items) {
+				if filter.Exists(key) {
+					falsePositives++
+				}
+			}
+			// Target of 1%, with room for the variance.
+			if rate := float64(falsePositives) / items; rate > 0.02 {
+				t.Errorf("false positive rate %.4f is above 0.02", rate)
+			}
+		})
+	}
+}
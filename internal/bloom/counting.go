@@ -0,0 +1,174 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// counterBits is the width of a counter, 16 counters are packed per word.
+const counterBits = 4
+
+// counterMax saturates the counters. A saturated counter is never decremented,
+// as the number of keys sharing it is not known anymore.
+const counterMax = 1<<counterBits - 1
+
+// CountingBloomFilter is a bloom filter supporting the removal of the keys,
+// safe for concurrent use.
+//
+// Every slot is a 4 bit counter instead of a bit, which takes 4 times the
+// memory of the BloomFilter for the same false positive rate. The counters are
+// updated with atomic operations, so neither Add, Remove nor Exists takes any lock.
+type CountingBloomFilter struct {
+	counters      []uint64 // 16 counters of 4 bits per word
+	size          uint64   // number of counters of the filter
+	hashFuncs     uint64   // number of counters incremented per key
+	expectedItems uint64
+	targetFpp     float64
+
+	nonZero atomic.Int64 // Number of counters above zero
+}
+
+// NewCountingBloomFilter helps to create a new counting bloom filter sized for
+// the expected number of items, with the target false positive rate once they are added.
+func NewCountingBloomFilter(expectedItems uint64, falsePositiveRate float64) *CountingBloomFilter {
+	n, p, size, hashFuncs := optimalSize(expectedItems, falsePositiveRate)
+
+	return &CountingBloomFilter{
+		counters:      make([]uint64, (size+15)/16),
+		size:          size,
+		hashFuncs:     hashFuncs,
+		expectedItems: n,
+		targetFpp:     p,
+	}
+}
+
+// Info returns the required information for the filter configuration
+func (cf *CountingBloomFilter) Info() map[string]any {
+	return map[string]any{
+		"type":           FilterCounting,
+		"size":           cf.size,
+		"bytes":          len(cf.counters) * 8,
+		"totalHashFuncs": cf.hashFuncs,
+		"expectedItems":  cf.expectedItems,
+		"targetFpp":      cf.targetFpp,
+		"fillRatio":      cf.FillRatio(),
+		"estimatedFpp":   cf.EstimatedFalsePositiveRate(),
+	}
+}
+
+// FillRatio returns the ratio of the counters above zero.
+func (cf *CountingBloomFilter) FillRatio() float64 {
+	return float64(cf.nonZero.Load()) / float64(cf.size)
+}
+
+// EstimatedFalsePositiveRate returns the current probability of a false positive.
+func (cf *CountingBloomFilter) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(cf.FillRatio(), float64(cf.hashFuncs))
+}
+
+// update applies fn to the counter at the index, returning its previous value.
+// fn returns the new value of the counter, and false to leave it untouched.
+func (cf *CountingBloomFilter) update(index uint64, fn func(count uint64) (uint64, bool)) uint64 {
+	word := &cf.counters[index/16]
+	shift := (index % 16) * counterBits
+
+	for {
+		old := atomic.LoadUint64(word)
+		count := (old >> shift) & counterMax
+		next, ok := fn(count)
+		if !ok {
+			return count
+		}
+		if atomic.CompareAndSwapUint64(word, old, old&^(counterMax<<shift)|next<<shift) {
+			return count
+		}
+	}
+}
+
+// Add helps to add the given key, incrementing its counters.
+// Adding a key twice requires removing it twice.
+func (cf *CountingBloomFilter) Add(key string) {
+	indexes(key, cf.size, cf.hashFuncs, func(index uint64) bool {
+		count := cf.update(index, func(count uint64) (uint64, bool) {
+			return count + 1, count < counterMax
+		})
+		if count == 0 {
+			cf.nonZero.Add(1)
+		}
+		return true
+	})
+}
+
+// Remove helps to remove the given key, decrementing its counters.
+// The key must have been added, see DeletableFilter.
+func (cf *CountingBloomFilter) Remove(key string) {
+	indexes(key, cf.size, cf.hashFuncs, func(index uint64) bool {
+		count := cf.update(index, func(count uint64) (uint64, bool) {
+			return count - 1, count > 0 && count < counterMax
+		})
+		if count == 1 {
+			cf.nonZero.Add(-1)
+		}
+		return true
+	})
+}
+
+// Exists helps to lookup if the key present, all of its counters are above zero.
+// In real, the key might not be present even if the return is true.
+func (cf *CountingBloomFilter) Exists(key string) bool {
+	exists := true
+	indexes(key, cf.size, cf.hashFuncs, func(index uint64) bool {
+		word := atomic.LoadUint64(&cf.counters[index/16])
+		exists = (word>>((index%16)*counterBits))&counterMax != 0
+		return exists
+	})
+	return exists
+}
+
+// countingSnapshotMagic prefixes the counting filter snapshots, versioning their encoding.
+var countingSnapshotMagic = []byte("CBF1")
+
+// MarshalBinary encodes the counters into a snapshot.
+// Implements the encoding.BinaryMarshaler.
+func (cf *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	header := len(countingSnapshotMagic) + 16
+	data := make([]byte, header+len(cf.counters)*8)
+	copy(data, countingSnapshotMagic)
+	binary.BigEndian.PutUint64(data[len(countingSnapshotMagic):], cf.size)
+	binary.BigEndian.PutUint64(data[len(countingSnapshotMagic)+8:], cf.hashFuncs)
+
+	for i := range cf.counters {
+		binary.BigEndian.PutUint64(data[header+i*8:], atomic.LoadUint64(&cf.counters[i]))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores the counters from a snapshot taken by MarshalBinary,
+// replacing the current ones. Must be called before the filter gets used.
+// Implements the encoding.BinaryUnmarshaler.
+func (cf *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	header := len(countingSnapshotMagic) + 16
+	if len(data) < header || string(data[:len(countingSnapshotMagic)]) != string(countingSnapshotMagic) {
+		return errors.New("invalid counting bloom filter snapshot")
+	}
+	size := binary.BigEndian.Uint64(data[len(countingSnapshotMagic):])
+	hashFuncs := binary.BigEndian.Uint64(data[len(countingSnapshotMagic)+8:])
+	if size != cf.size || hashFuncs != cf.hashFuncs || len(data)-header != len(cf.counters)*8 {
+		return ErrSnapshotMismatch
+	}
+
+	var nonZero int64
+	for i := range cf.counters {
+		word := binary.BigEndian.Uint64(data[header+i*8:])
+		atomic.StoreUint64(&cf.counters[i], word)
+		for ; word != 0; word >>= counterBits {
+			if word&counterMax != 0 {
+				nonZero++
+			}
+		}
+	}
+	cf.nonZero.Store(nonZero)
+	return nil
+}
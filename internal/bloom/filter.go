@@ -0,0 +1,90 @@
+package bloom
+
+import (
+	"encoding"
+	"math"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// Filter is a probabilistic set membership filter of the short url aliases.
+// Exists never misses a key added, but may report a key never added.
+type Filter interface {
+	Add(key string)
+	Exists(key string) bool
+	Info() map[string]any
+	FillRatio() float64
+	EstimatedFalsePositiveRate() float64
+
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// DeletableFilter is a Filter supporting the removal of the keys.
+// Only the keys added must be removed, removing any other key may remove the
+// keys sharing its slots.
+type DeletableFilter interface {
+	Filter
+	Remove(key string)
+}
+
+// BatchFilter is a Filter adding many keys at once, cheaper than one by one.
+type BatchFilter interface {
+	Filter
+	AddMany(keys []string)
+}
+
+// AddMany helps to add the keys into the filter, in a single batch when supported.
+func AddMany(filter Filter, keys []string) {
+	if batch, ok := filter.(BatchFilter); ok {
+		batch.AddMany(keys)
+		return
+	}
+	for _, key := range keys {
+		filter.Add(key)
+	}
+}
+
+// Available filter types.
+const (
+	FilterStandard = "standard"
+	FilterCounting = "counting"
+)
+
+// NewFilter helps to create a new filter of the given type, sized for the
+// expected number of items with the target false positive rate.
+func NewFilter(filterType string, expectedItems uint64, falsePositiveRate float64) Filter {
+	if filterType == FilterCounting {
+		return NewCountingBloomFilter(expectedItems, falsePositiveRate)
+	}
+	return NewBloomFilter(expectedItems, falsePositiveRate)
+}
+
+// optimalSize returns the number of slots m = -n * ln(p) / ln(2)^2 and the
+// number of hash functions k = m / n * ln(2), for n items with the false
+// positive rate p (both bounded to sane values).
+func optimalSize(expectedItems uint64, falsePositiveRate float64) (n uint64, p float64, size uint64, hashFuncs uint64) {
+	n = max(expectedItems, 1)
+	p = min(max(falsePositiveRate, 1e-9), 0.5)
+
+	size = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	hashFuncs = uint64(max(math.Round(float64(size)/float64(n)*math.Ln2), 1))
+	return n, p, size, hashFuncs
+}
+
+// indexes computes the murmur3 128 bit hash of the key once, and derives the
+// i-th index as h1 + i * h2 (Kirsch-Mitzenmacher double hashing).
+// Stops as soon as fn returns false.
+//
+// Non-cryptographic hash, fast and efficient and without any shared state.
+func indexes(key string, size, hashFuncs uint64, fn func(index uint64) bool) {
+	h1, h2 := murmur3.Sum128([]byte(key))
+	// An odd h2 never cycles early through the indexes.
+	h2 |= 1
+
+	for i := uint64(0); i < hashFuncs; i++ {
+		if !fn((h1 + i*h2) % size) {
+			return
+		}
+	}
+}
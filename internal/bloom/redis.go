@@ -0,0 +1,172 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisTimeout bounds every redis call of the RedisBloomFilter.
+const redisTimeout = 1 * time.Second
+
+// ErrSnapshotUnsupported is returned by the filters living outside of the replica.
+var ErrSnapshotUnsupported = errors.New("bloom filter snapshots are not supported by the redis filter")
+
+// RedisBloomFilter is a bloom filter stored in a redis bitmap, shared by every replica.
+//
+// The indexes of a key are set and read in a single pipelined round trip.
+// The filter can not return an error, so Exists reports the key as present
+// when redis is unreachable (the safe answer for an alias), and the failures
+// are only reported to onError.
+type RedisBloomFilter struct {
+	rdb       redis.UniversalClient
+	key       string
+	size      uint64
+	hashFuncs uint64
+
+	expectedItems uint64
+	targetFpp     float64
+	onError       func(err error)
+}
+
+// NewRedisBloomFilter helps to create a new redis bloom filter sized for the
+// expected number of items, with the target false positive rate once they are added.
+//
+// The size is part of the redis key, so replicas sized differently never share a bitmap.
+func NewRedisBloomFilter(rdb redis.UniversalClient, keyPrefix string, expectedItems uint64, falsePositiveRate float64, onError func(err error)) *RedisBloomFilter {
+	n, p, size, hashFuncs := optimalSize(expectedItems, falsePositiveRate)
+
+	return &RedisBloomFilter{
+		rdb:           rdb,
+		key:           fmt.Sprintf("%s:%d:%d", keyPrefix, size, hashFuncs),
+		size:          size,
+		hashFuncs:     hashFuncs,
+		expectedItems: n,
+		targetFpp:     p,
+		onError:       onError,
+	}
+}
+
+// Key returns the redis key of the bitmap.
+func (rf *RedisBloomFilter) Key() string {
+	return rf.key
+}
+
+// Add helps to set the bits of the key in the redis bitmap.
+func (rf *RedisBloomFilter) Add(key string) {
+	rf.AddMany([]string{key})
+}
+
+// AddMany helps to set the bits of the keys in the redis bitmap, in a single round trip.
+func (rf *RedisBloomFilter) AddMany(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := rf.rdb.Pipeline()
+	for _, key := range keys {
+		indexes(key, rf.size, rf.hashFuncs, func(index uint64) bool {
+			pipe.SetBit(ctx, rf.key, int64(index), 1)
+			return true
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && rf.onError != nil {
+		rf.onError(err)
+	}
+}
+
+// Exists helps to lookup if the bits of the key are set in the redis bitmap.
+// Reports the key as present when redis is unreachable.
+func (rf *RedisBloomFilter) Exists(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := rf.rdb.Pipeline()
+	bits := make([]*redis.IntCmd, 0, rf.hashFuncs)
+	indexes(key, rf.size, rf.hashFuncs, func(index uint64) bool {
+		bits = append(bits, pipe.GetBit(ctx, rf.key, int64(index)))
+		return true
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		if rf.onError != nil {
+			rf.onError(err)
+		}
+		return true
+	}
+
+	for _, bit := range bits {
+		if bit.Val() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RenameTo helps to move the bitmap over the redis key of the other filter,
+// e.g. once rebuilt. Both filters must have the same size.
+func (rf *RedisBloomFilter) RenameTo(ctx context.Context, other *RedisBloomFilter) error {
+	if rf.size != other.size || rf.hashFuncs != other.hashFuncs {
+		return ErrSnapshotMismatch
+	}
+
+	// An empty bitmap is no key at all in redis.
+	found, err := rf.rdb.Exists(ctx, rf.key).Result()
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		err = rf.rdb.Del(ctx, other.key).Err()
+	} else {
+		err = rf.rdb.Rename(ctx, rf.key, other.key).Err()
+	}
+	if err != nil {
+		return err
+	}
+	rf.key = other.key
+	return nil
+}
+
+// Info returns the required information for the filter configuration
+func (rf *RedisBloomFilter) Info() map[string]any {
+	return map[string]any{
+		"type":           "redis",
+		"key":            rf.key,
+		"size":           rf.size,
+		"bytes":          (rf.size + 7) / 8,
+		"totalHashFuncs": rf.hashFuncs,
+		"expectedItems":  rf.expectedItems,
+		"targetFpp":      rf.targetFpp,
+		"fillRatio":      rf.FillRatio(),
+		"estimatedFpp":   rf.EstimatedFalsePositiveRate(),
+	}
+}
+
+// FillRatio returns the ratio of the bits set in the redis bitmap.
+func (rf *RedisBloomFilter) FillRatio() float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	setBits, err := rf.rdb.BitCount(ctx, rf.key, nil).Result()
+	if err != nil {
+		return 0
+	}
+	return float64(setBits) / float64(rf.size)
+}
+
+// EstimatedFalsePositiveRate returns the current probability of a false positive.
+func (rf *RedisBloomFilter) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(rf.FillRatio(), float64(rf.hashFuncs))
+}
+
+// MarshalBinary is not supported, the bitmap already outlives the replicas.
+func (rf *RedisBloomFilter) MarshalBinary() ([]byte, error) {
+	return nil, ErrSnapshotUnsupported
+}
+
+// UnmarshalBinary is not supported, the bitmap already outlives the replicas.
+func (rf *RedisBloomFilter) UnmarshalBinary(data []byte) error {
+	return ErrSnapshotUnsupported
+}
@@ -0,0 +1,200 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Growth of the scalable bloom filter stages. Every new stage holds
+// scalableGrowth times the items of the previous one, with a false positive
+// rate scalableTightening times lower, so the overall rate stays bounded by
+// the target: p0 / (1 - r) = p.
+const (
+	scalableGrowth     = 2
+	scalableTightening = 0.5
+)
+
+// ScalableBloomFilter is a chain of filters growing with the number of keys
+// added, safe for concurrent use. The keys are added into the latest stage,
+// and a new stage gets chained once it holds its expected number of items.
+//
+// A key exists when any of the stages reports it. The removals are not
+// supported: the stage holding a key is not known, and removing it from a
+// stage reporting it falsely would remove the keys that stage holds.
+type ScalableBloomFilter struct {
+	stages atomic.Pointer[[]*scalableStage]
+	grow   sync.Mutex
+
+	filterType    string
+	expectedItems uint64
+	targetFpp     float64
+}
+
+type scalableStage struct {
+	filter        Filter
+	expectedItems uint64
+	fpp           float64
+	items         atomic.Int64
+}
+
+// NewScalableBloomFilter helps to create a new scalable bloom filter, with a first
+// stage of the given type sized for the expected number of items. The false
+// positive rate stays below the target however many keys are added.
+func NewScalableBloomFilter(filterType string, expectedItems uint64, falsePositiveRate float64) *ScalableBloomFilter {
+	n, p, _, _ := optimalSize(expectedItems, falsePositiveRate)
+
+	sf := &ScalableBloomFilter{filterType: filterType, expectedItems: n, targetFpp: p}
+	stages := []*scalableStage{sf.newStage(n, p*(1-scalableTightening))}
+	sf.stages.Store(&stages)
+	return sf
+}
+
+func (sf *ScalableBloomFilter) newStage(expectedItems uint64, fpp float64) *scalableStage {
+	return &scalableStage{
+		filter:        NewFilter(sf.filterType, expectedItems, fpp),
+		expectedItems: expectedItems,
+		fpp:           fpp,
+	}
+}
+
+// latest returns the stage the keys are added into, chaining a new one when full.
+func (sf *ScalableBloomFilter) latest() *scalableStage {
+	stages := *sf.stages.Load()
+	last := stages[len(stages)-1]
+	if uint64(last.items.Load()) < last.expectedItems {
+		return last
+	}
+
+	sf.grow.Lock()
+	defer sf.grow.Unlock()
+
+	// Chained by a concurrent Add in the meantime.
+	stages = *sf.stages.Load()
+	last = stages[len(stages)-1]
+	if uint64(last.items.Load()) < last.expectedItems {
+		return last
+	}
+
+	next := sf.newStage(last.expectedItems*scalableGrowth, last.fpp*scalableTightening)
+	grown := append(append(make([]*scalableStage, 0, len(stages)+1), stages...), next)
+	sf.stages.Store(&grown)
+	return next
+}
+
+// Add helps to add the given key into the latest stage.
+func (sf *ScalableBloomFilter) Add(key string) {
+	stage := sf.latest()
+	stage.filter.Add(key)
+	stage.items.Add(1)
+}
+
+// Exists helps to lookup if the key present in any of the stages.
+func (sf *ScalableBloomFilter) Exists(key string) bool {
+	for _, stage := range *sf.stages.Load() {
+		if stage.filter.Exists(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Info returns the required information for the filter configuration
+func (sf *ScalableBloomFilter) Info() map[string]any {
+	stages := *sf.stages.Load()
+	stagesInfo := make([]map[string]any, 0, len(stages))
+	for _, stage := range stages {
+		info := stage.filter.Info()
+		info["items"] = stage.items.Load()
+		stagesInfo = append(stagesInfo, info)
+	}
+
+	return map[string]any{
+		"type":          "scalable",
+		"stageType":     sf.filterType,
+		"expectedItems": sf.expectedItems,
+		"targetFpp":     sf.targetFpp,
+		"fillRatio":     sf.FillRatio(),
+		"estimatedFpp":  sf.EstimatedFalsePositiveRate(),
+		"stages":        stagesInfo,
+	}
+}
+
+// FillRatio returns the fill ratio of the latest stage, the one growing.
+func (sf *ScalableBloomFilter) FillRatio() float64 {
+	stages := *sf.stages.Load()
+	return stages[len(stages)-1].filter.FillRatio()
+}
+
+// EstimatedFalsePositiveRate returns the current probability of a false positive,
+// the probability of any of the stages reporting a false positive.
+func (sf *ScalableBloomFilter) EstimatedFalsePositiveRate() float64 {
+	none := 1.0
+	for _, stage := range *sf.stages.Load() {
+		none *= 1 - stage.filter.EstimatedFalsePositiveRate()
+	}
+	return 1 - none
+}
+
+// scalableSnapshotMagic prefixes the scalable filter snapshots, versioning their encoding.
+var scalableSnapshotMagic = []byte("SBF1")
+
+// MarshalBinary encodes every stage into a snapshot.
+// Implements the encoding.BinaryMarshaler.
+func (sf *ScalableBloomFilter) MarshalBinary() ([]byte, error) {
+	stages := *sf.stages.Load()
+
+	data := append([]byte{}, scalableSnapshotMagic...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(stages)))
+	for _, stage := range stages {
+		filter, err := stage.filter.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint64(data, stage.expectedItems)
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(stage.fpp))
+		data = binary.BigEndian.AppendUint64(data, uint64(stage.items.Load()))
+		data = binary.BigEndian.AppendUint64(data, uint64(len(filter)))
+		data = append(data, filter...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores the stages from a snapshot taken by MarshalBinary,
+// replacing the current ones. Must be called before the filter gets used.
+// Implements the encoding.BinaryUnmarshaler.
+func (sf *ScalableBloomFilter) UnmarshalBinary(data []byte) error {
+	invalid := errors.New("invalid scalable bloom filter snapshot")
+	if len(data) < len(scalableSnapshotMagic)+4 || string(data[:len(scalableSnapshotMagic)]) != string(scalableSnapshotMagic) {
+		return invalid
+	}
+	count := binary.BigEndian.Uint32(data[len(scalableSnapshotMagic):])
+	data = data[len(scalableSnapshotMagic)+4:]
+
+	stages := make([]*scalableStage, 0, count)
+	for i := uint32(0); i < count; i++ {
+		if len(data) < 32 {
+			return invalid
+		}
+		stage := sf.newStage(binary.BigEndian.Uint64(data), math.Float64frombits(binary.BigEndian.Uint64(data[8:])))
+		stage.items.Store(int64(binary.BigEndian.Uint64(data[16:])))
+		length := binary.BigEndian.Uint64(data[24:])
+		data = data[32:]
+		if uint64(len(data)) < length {
+			return invalid
+		}
+		if err := stage.filter.UnmarshalBinary(data[:length]); err != nil {
+			return err
+		}
+		data = data[length:]
+		stages = append(stages, stage)
+	}
+	if len(stages) == 0 || stages[0].expectedItems != sf.expectedItems {
+		return ErrSnapshotMismatch
+	}
+
+	sf.stages.Store(&stages)
+	return nil
+}
@@ -0,0 +1,87 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNoSnapshot is returned when no snapshot has been saved yet.
+var ErrNoSnapshot = errors.New("no bloom filter snapshot found")
+
+// SnapshotStore persists the bloom.Filter snapshots across the restarts.
+type SnapshotStore interface {
+	// Load returns the latest snapshot saved, or ErrNoSnapshot.
+	Load(ctx context.Context) ([]byte, error)
+	// Save replaces the latest snapshot.
+	Save(ctx context.Context, data []byte) error
+}
+
+// Available snapshot stores.
+const (
+	SnapshotNone  = "none"
+	SnapshotFile  = "file"
+	SnapshotRedis = "redis"
+)
+
+// FileSnapshotStore keeps the snapshot in a local file, owned by the replica.
+type FileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore helps to create a new snapshot store writing to the file path.
+func NewFileSnapshotStore(path string) *FileSnapshotStore {
+	return &FileSnapshotStore{path: path}
+}
+
+func (s *FileSnapshotStore) Load(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSnapshot
+	}
+	return data, err
+}
+
+func (s *FileSnapshotStore) Save(ctx context.Context, data []byte) error {
+	// Write aside and rename, so a crash never leaves a truncated snapshot.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// RedisSnapshotStore keeps the snapshot in a redis key, shared by every replica.
+type RedisSnapshotStore struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+// NewRedisSnapshotStore helps to create a new snapshot store writing to the redis key.
+func NewRedisSnapshotStore(rdb redis.UniversalClient, key string) *RedisSnapshotStore {
+	return &RedisSnapshotStore{rdb: rdb, key: key}
+}
+
+func (s *RedisSnapshotStore) Load(ctx context.Context) ([]byte, error) {
+	data, err := s.rdb.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNoSnapshot
+	}
+	return data, err
+}
+
+func (s *RedisSnapshotStore) Save(ctx context.Context, data []byte) error {
+	return s.rdb.Set(ctx, s.key, data, 0).Err()
+}
@@ -0,0 +1,33 @@
+package breaker
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes the exponentially growing delays between the retries of a
+// failing operation, with a random jitter so the replicas do not retry in sync.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	attempt int
+}
+
+// Next returns the delay to wait before the next retry.
+func (b *Backoff) Next() time.Duration {
+	delay := b.Min << min(b.attempt, 30)
+	if delay <= 0 || delay > b.Max {
+		delay = b.Max
+	}
+	b.attempt++
+
+	// Full jitter on the upper half: [delay/2, delay).
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// Reset starts the delays over, once the operation succeeds.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,199 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned when the call is rejected by an open circuit breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every call through, counting the consecutive failures.
+	Closed State = iota
+	// Open rejects every call until the cooldown elapses.
+	Open
+	// HalfOpen lets a single probe call through, closing the breaker on success.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a circuit breaker guarding the calls to a dependency.
+//
+// It opens after failureThreshold consecutive failures, so the callers stop
+// waiting on a dependency which is down. Once the cooldown elapses a single
+// probe call is let through, closing the breaker when it succeeds and opening
+// it again for another cooldown when it fails.
+type Breaker struct {
+	name             string
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu          sync.Mutex
+	state       State
+	failures    int
+	openedAt    time.Time
+	probeActive bool
+}
+
+// New helps to create a new closed circuit breaker.
+func New(name string, failureThreshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		name:             name,
+		failureThreshold: max(failureThreshold, 1),
+		cooldown:         cooldown,
+	}
+}
+
+// Name returns the name of the guarded dependency.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow reports whether the call can go through.
+// Every allowed call must be followed by Success, Failure or Release.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		b.probeActive = true
+		return true
+	case HalfOpen:
+		if b.probeActive {
+			return false
+		}
+		b.probeActive = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a successful call.
+func (b *Breaker) Success() {
+	b.succeed(time.Now())
+}
+
+// Failure records a failed call.
+func (b *Breaker) Failure() {
+	b.fail(time.Now())
+}
+
+// Release records a call which tells nothing about the dependency, neither
+// a success nor a failure. A half-open breaker lets another probe through.
+func (b *Breaker) Release() {
+	b.release(time.Now())
+}
+
+// succeed records a successful call admitted at admittedAt. Only the probe of
+// a half-open breaker closes it: an open breaker stays open, and the slow calls
+// admitted before the breaker opened are ignored.
+func (b *Breaker) succeed(admittedAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open || admittedAt.Before(b.openedAt) {
+		return
+	}
+	b.state = Closed
+	b.failures = 0
+	b.probeActive = false
+}
+
+// fail records a failed call admitted at admittedAt. The slow calls admitted
+// before the breaker opened are ignored, they would free the probe of the
+// half-open breaker.
+func (b *Breaker) fail(admittedAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if admittedAt.Before(b.openedAt) {
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.failureThreshold {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+	b.probeActive = false
+}
+
+// release records a neutral call admitted at admittedAt.
+func (b *Breaker) release(admittedAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if admittedAt.Before(b.openedAt) {
+		return
+	}
+	b.probeActive = false
+}
+
+// Do runs fn when the breaker allows it and records its outcome.
+// Returns ErrOpen without running fn when the breaker is open.
+//
+// A call canceled by its caller is not a failure, the caller gave up, which
+// does not mean the dependency is down. A call running out of time is one.
+func (b *Breaker) Do(fn func() error) error {
+	if !b.Allow() {
+		return ErrOpen
+	}
+	admittedAt := time.Now()
+	err := fn()
+	switch {
+	case err == nil:
+		b.succeed(admittedAt)
+	case errors.Is(err, context.Canceled):
+		b.release(admittedAt)
+	default:
+		b.fail(admittedAt)
+	}
+	return err
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Info returns the required information of the breaker for the health checks.
+func (b *Breaker) Info() map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info := map[string]any{
+		"state":    b.state.String(),
+		"failures": b.failures,
+	}
+	if b.state != Closed {
+		info["openedAt"] = b.openedAt
+	}
+	return info
+}
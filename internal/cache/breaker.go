@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+)
+
+// BreakerCache guards a Cache with a circuit breaker, so the callers stop
+// waiting on a cache backend which is down. A miss is not a failure.
+type BreakerCache struct {
+	next    Cache
+	breaker *breaker.Breaker
+}
+
+// WithBreaker helps to guard the cache with the circuit breaker.
+func WithBreaker(next Cache, b *breaker.Breaker) *BreakerCache {
+	return &BreakerCache{next: next, breaker: b}
+}
+
+func (c *BreakerCache) Get(ctx context.Context, key string) (string, time.Duration, error) {
+	var value string
+	var ttl time.Duration
+	var missed bool
+
+	err := c.breaker.Do(func() error {
+		var err error
+		value, ttl, err = c.next.Get(ctx, key)
+		if errors.Is(err, ErrMiss) {
+			missed = true
+			return nil
+		}
+		return err
+	})
+	if missed {
+		return "", 0, ErrMiss
+	}
+	return value, ttl, err
+}
+
+func (c *BreakerCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.breaker.Do(func() error {
+		return c.next.Set(ctx, key, value, ttl)
+	})
+}
+
+func (c *BreakerCache) SetMany(ctx context.Context, entries []Entry) error {
+	return c.breaker.Do(func() error {
+		return c.next.SetMany(ctx, entries)
+	})
+}
+
+func (c *BreakerCache) Delete(ctx context.Context, keys ...string) error {
+	return c.breaker.Do(func() error {
+		return c.next.Delete(ctx, keys...)
+	})
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned when the key is not present in the cache.
+var ErrMiss = errors.New("cache miss")
+
+// Cache is the shared cache backend of the service.
+type Cache interface {
+	// Get returns the value of the key with its remaining lifetime, or ErrMiss.
+	Get(ctx context.Context, key string) (string, time.Duration, error)
+	// Set adds or replaces the value of the key, living for ttl.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetMany adds or replaces the entries in a single batch.
+	SetMany(ctx context.Context, entries []Entry) error
+	// Delete removes the keys from the cache.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Entry is a key value pair of a batch, living for TTL.
+type Entry struct {
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// Available cache backends.
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendNone   = "none"
+)
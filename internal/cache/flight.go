@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Group coalesces the concurrent calls made for the same key into a single
+// execution, every caller receiving the result of that execution.
+//
+// Unlike a cache, the result is forgotten as soon as the execution completes.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// ErrPanicked is returned to the waiters of an execution which panicked.
+var ErrPanicked = errors.New("coalesced call panicked")
+
+type call[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// Do executes fn for the key, unless an execution for the key is already in
+// flight, in which case it waits for it and returns its result instead.
+//
+// coalesced reports whether the caller has been served by the execution of
+// another caller.
+func (g *Group[T]) Do(key string, fn func() (T, error)) (val T, err error, coalesced bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	if c, found := g.calls[key]; found {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &call[T]{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// Always release the waiters, even if fn panics. They get ErrPanicked
+	// rather than a zero value, while the panic goes on in the caller.
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			c.err = fmt.Errorf("%w: %v", ErrPanicked, recovered)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process, size bounded, least recently used cache.
+//
+// Every entry expires after the TTL of the cache, or earlier when its own
+// expiry is sooner. Expired entries are dropped lazily on access, and the least
+// recently used entries are evicted once the capacity is reached.
+type LRU struct {
+	capacity int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List // front is the most recently used
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// NewLRU helps to create a new LRU cache holding at most capacity entries,
+// each living at most ttl.
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value of the key when present and not expired.
+func (c *LRU) Get(key string) (string, bool) {
+	value, _, found := c.GetWithExpiry(key)
+	return value, found
+}
+
+// GetWithExpiry returns the value of the key with its expiry, when present and not expired.
+func (c *LRU) GetWithExpiry(key string) (string, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		return "", time.Time{}, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return "", time.Time{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, entry.expiresAt, true
+}
+
+// Set adds or replaces the value of the key. The entry expires after the TTL
+// of the cache, or at expiresAt when sooner.
+func (c *LRU) Set(key, value string, expiresAt time.Time) {
+	if c.capacity <= 0 {
+		return
+	}
+	if maxExpiresAt := time.Now().Add(c.ttl); expiresAt.IsZero() || expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+	if !time.Now().Before(expiresAt) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.items[key]; found {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	// Evict the least recently used entries.
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Delete removes the key from the cache.
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.items[key]; found {
+		c.removeElement(elem)
+	}
+}
+
+// Len returns the number of entries in the cache, including the expired ones not dropped yet.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// memoryMaxTTL bounds the lifetime of the MemoryCache entries set without a TTL.
+const memoryMaxTTL = 365 * 24 * time.Hour
+
+// MemoryCache is an in-process Cache, handy for the local development and the
+// single replica deployments. Every replica holds its own entries.
+type MemoryCache struct {
+	lru *LRU
+}
+
+// NewMemoryCache helps to create a new in-process cache holding at most capacity entries.
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{lru: NewLRU(capacity, memoryMaxTTL)}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, time.Duration, error) {
+	value, expiresAt, found := c.lru.GetWithExpiry(key)
+	if !found {
+		return "", 0, ErrMiss
+	}
+	return value, time.Until(expiresAt), nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	c.lru.Set(key, value, expiresAt)
+	return nil
+}
+
+func (c *MemoryCache) SetMany(ctx context.Context, entries []Entry) error {
+	for _, entry := range entries {
+		c.Set(ctx, entry.Key, entry.Value, entry.TTL)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		c.lru.Delete(key)
+	}
+	return nil
+}
+
+// NoopCache is a Cache which never holds anything, every lookup is a miss.
+type NoopCache struct{}
+
+func (NoopCache) Get(ctx context.Context, key string) (string, time.Duration, error) {
+	return "", 0, ErrMiss
+}
+
+func (NoopCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return nil
+}
+
+func (NoopCache) SetMany(ctx context.Context, entries []Entry) error {
+	return nil
+}
+
+func (NoopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
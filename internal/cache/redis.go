@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisOptions configures the redis client of the RedisCache.
+//
+// The deployment is picked from the options:
+// - ClusterAddrs: redis cluster
+// - SentinelAddrs (with SentinelMaster): redis sentinel
+// - Addr: standalone redis
+type RedisOptions struct {
+	Addr           string
+	Password       string
+	DB             int
+	TLS            bool
+	SentinelAddrs  []string
+	SentinelMaster string
+	ClusterAddrs   []string
+	Timeout        time.Duration // dial, read and write timeout
+}
+
+// NewRedisClient helps to create the redis client for the configured deployment.
+func NewRedisClient(opts RedisOptions) redis.UniversalClient {
+	var tlsConfig *tls.Config
+	if opts.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	switch {
+	case len(opts.ClusterAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opts.ClusterAddrs,
+			Password:  opts.Password,
+			TLSConfig: tlsConfig,
+
+			DialTimeout:  opts.Timeout,
+			ReadTimeout:  opts.Timeout,
+			WriteTimeout: opts.Timeout,
+		})
+	case len(opts.SentinelAddrs) > 0:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    opts.SentinelMaster,
+			SentinelAddrs: opts.SentinelAddrs,
+			Password:      opts.Password,
+			DB:            opts.DB,
+			TLSConfig:     tlsConfig,
+
+			DialTimeout:  opts.Timeout,
+			ReadTimeout:  opts.Timeout,
+			WriteTimeout: opts.Timeout,
+		})
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:      opts.Addr,
+			Password:  opts.Password,
+			DB:        opts.DB,
+			TLSConfig: tlsConfig,
+
+			DialTimeout:  opts.Timeout,
+			ReadTimeout:  opts.Timeout,
+			WriteTimeout: opts.Timeout,
+		})
+	}
+}
+
+// RedisCache is a Cache backed by redis, shared by every replica.
+type RedisCache struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedisCache helps to create a new redis backed cache.
+func NewRedisCache(rdb redis.UniversalClient) *RedisCache {
+	return &RedisCache{rdb: rdb}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, time.Duration, error) {
+	// Fetch the value and its TTL in a single round trip.
+	pipe := c.rdb.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	_, err := pipe.Exec(ctx)
+	if errors.Is(err, redis.Nil) {
+		return "", 0, ErrMiss
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return get.Val(), pttl.Val(), nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) SetMany(ctx context.Context, entries []Entry) error {
+	// Send the whole batch in a single round trip.
+	pipe := c.rdb.Pipeline()
+	for _, entry := range entries {
+		pipe.Set(ctx, entry.Key, entry.Value, entry.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	return c.rdb.Del(ctx, keys...).Err()
+}
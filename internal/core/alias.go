@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
+)
+
+// Reasons a custom alias is not available.
+const (
+	AliasTaken    = "taken"
+	AliasReserved = "reserved"
+	AliasInvalid  = "invalid"
+)
+
+// Length bounds of a custom alias, at most the url_mappings.short_url column.
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 20
+)
+
+// aliasPattern are the characters allowed in a custom alias, as they are
+// served right under the root path.
+var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// reservedAliases can never be used as custom aliases, as they collide with
+// the routes of the service or could be mistaken for them.
+var reservedAliases = []string{
+	"api", "admin", "login", "logout", "signup", "metrics", "health",
+	"healthy", "ready", "static", "assets", "favicon.ico", "robots.txt",
+}
+
+// aliasSuggestionWords are the words combined with a taken alias to suggest similar ones.
+var aliasSuggestionWords = []string{"go", "my", "get", "the", "app", "link", "hq", "now"}
+
+// CheckAliasAvailability helps to check whether the custom alias can be used
+// for a new short url.
+//
+// The bloom filter only rejects the aliases which are definitely free without
+// any lookup. Its positives are confirmed against the database, so a false
+// positive never reports an alias as taken. An expired alias is available, as
+// creating a short url with it reclaims it.
+//
+// Suggests available alternative aliases when the alias is taken or reserved.
+// Returns ErrUnavailable when the database is unavailable.
+func (co *Core) CheckAliasAvailability(ctx context.Context, alias string) (models.AliasAvailability, error) {
+	availability := models.AliasAvailability{Alias: alias, Available: true}
+
+	if err := validateAlias(alias); err != nil {
+		availability.Available = false
+		availability.Reason = AliasInvalid
+		availability.Message = err.Error()
+		return availability, nil
+	}
+
+	if co.isReservedAlias(alias) {
+		availability.Available = false
+		availability.Reason = AliasReserved
+		availability.Message = "alias is reserved. Try another one."
+	} else {
+		taken, err := co.isAliasTaken(ctx, alias)
+		if err != nil {
+			return availability, err
+		}
+		if taken {
+			availability.Available = false
+			availability.Reason = AliasTaken
+			availability.Message = "alias is already taken. Try another one."
+		}
+	}
+
+	if availability.Available {
+		availability.Message = "alias is available."
+		return availability, nil
+	}
+
+	// The suggestions are best effort, the verdict of the alias stands anyway.
+	suggestions, err := co.suggestAliases(ctx, alias)
+	if err != nil {
+		co.Lo.Error("unable to suggest the aliases", "alias", alias, "error", err)
+	}
+	availability.Suggestions = suggestions
+
+	return availability, nil
+}
+
+// validateAlias helps to check the length and the characters of the custom alias.
+func validateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("alias must be %d to %d characters long", aliasMinLength, aliasMaxLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("alias must only contain letters, digits, '-' and '_'")
+	}
+	return nil
+}
+
+// isReservedAlias helps to check whether the alias is one of the reserved ones,
+// the built-in or the configured (RESERVED_ALIASES) ones.
+func (co *Core) isReservedAlias(alias string) bool {
+	for _, reserved := range reservedAliases {
+		if strings.EqualFold(reserved, alias) {
+			return true
+		}
+	}
+	for _, reserved := range co.ReservedAliases {
+		if strings.EqualFold(reserved, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAliasTaken helps to check whether an active short url uses the alias.
+//
+// With a shared (pubsub or redis) bloom filter, the database is only queried
+// on a bloom filter positive, or while the bloom filter is not loaded yet.
+// With the local sharing the filter misses the aliases created by the other
+// replicas until the next sync, so its negatives are confirmed as well.
+func (co *Core) isAliasTaken(ctx context.Context, alias string) (bool, error) {
+	bloomChecked := co.bloomLoaded.Load() && co.BloomSharing != BloomSharingLocal
+	if bloomChecked && !co.BloomFilter.Exists(alias) {
+		return false, nil
+	}
+
+	var originalUrl string
+	var expirationAt time.Time
+	var missing bool
+	err := co.dbBreaker.Do(func() error {
+		err := co.QueryStmts.GetShortUrlQuery.QueryRowContext(ctx, alias).Scan(&originalUrl, &expirationAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			missing = true
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, breaker.ErrOpen) {
+		return false, ErrUnavailable
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if missing && bloomChecked {
+		metrics.BloomFalsePositives.Inc()
+	}
+	return !missing, nil
+}
+
+// suggestAliases helps to find up to AliasSuggestions available aliases
+// similar to the alias, made of the alias with suffixes and words.
+func (co *Core) suggestAliases(ctx context.Context, alias string) ([]string, error) {
+	suggestions := make([]string, 0, co.AliasSuggestions)
+	for _, candidate := range aliasCandidates(alias) {
+		if len(suggestions) >= co.AliasSuggestions {
+			break
+		}
+		if validateAlias(candidate) != nil || co.isReservedAlias(candidate) {
+			continue
+		}
+		taken, err := co.isAliasTaken(ctx, candidate)
+		if err != nil {
+			return suggestions, err
+		}
+		if !taken {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions, nil
+}
+
+// aliasCandidates returns the alternatives of the alias, the closest first.
+// Bounded, so a popular alias costs a few lookups only.
+func aliasCandidates(alias string) []string {
+	base := strings.Trim(alias, "-_")
+	if len(base) == 0 {
+		base = alias
+	}
+	// Room for the suffixes and words.
+	if len(base) > aliasMaxLength-5 {
+		base = base[:aliasMaxLength-5]
+	}
+
+	candidates := make([]string, 0, 24)
+	for i := 1; i <= 3; i++ {
+		candidates = append(candidates, fmt.Sprintf("%s%d", base, i))
+	}
+	for _, word := range aliasSuggestionWords {
+		candidates = append(candidates, base+"-"+word, word+"-"+base)
+	}
+	candidates = append(candidates, fmt.Sprintf("%s%d", base, time.Now().Year()))
+	for range 4 {
+		candidates = append(candidates, fmt.Sprintf("%s-%d", base, rand.IntN(900)+100))
+	}
+	return candidates
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/leader"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/tracing"
+)
+
+// Leaderboard scopes supported by GetTopLinks.
+const (
+	ScopeMe        = "me"
+	ScopeWorkspace = "workspace"
+	ScopeGlobal    = "global"
+)
+
+// publicMailDomains are the domains of the public mail providers, whose users
+// never share a workspace.
+var publicMailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"msn.com":        true,
+	"yahoo.com":      true,
+	"ymail.com":      true,
+	"icloud.com":     true,
+	"me.com":         true,
+	"aol.com":        true,
+	"proton.me":      true,
+	"protonmail.com": true,
+	"gmx.com":        true,
+	"mail.com":       true,
+	"yandex.com":     true,
+	"zoho.com":       true,
+}
+
+// validateWorkspaceDomains helps to reject the public mail domains out of the WORKSPACE_DOMAINS.
+func validateWorkspaceDomains(domains []string) error {
+	for _, domain := range domains {
+		if publicMailDomains[strings.ToLower(domain)] {
+			return fmt.Errorf("WORKSPACE_DOMAINS must not have a public mail domain: %s", domain)
+		}
+	}
+	return nil
+}
+
+// WorkspaceDomain helps to find the workspace of the user, the domain of its email.
+// Only the domains of WORKSPACE_DOMAINS are workspaces, returns false otherwise.
+func (co *Core) WorkspaceDomain(email string) (string, bool) {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return "", false
+	}
+	domain := strings.ToLower(email[at+1:])
+	if publicMailDomains[domain] {
+		return "", false
+	}
+
+	for _, workspaceDomain := range co.WorkspaceDomains {
+		if strings.EqualFold(workspaceDomain, domain) {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// GetTopLinks helps to fetch the trending links for the given window.
+//
+// Links are ranked on their recent click velocity (human hits inside the window)
+// rather than their lifetime hit_count, so a freshly shared link beats an old one.
+//
+// The scope decides whose links are considered:
+// - me: links of the user
+// - workspace: links of every user of the workspace domain (caller must make sure it is the WorkspaceDomain of the user)
+// - global: every link (caller must make sure the user is an admin)
+func (co *Core) GetTopLinks(ctx context.Context, window time.Duration, scope string, userID int, workspaceDomain string, limit int) ([]models.TopLink, error) {
+	interval := fmt.Sprintf("%d seconds", int64(window.Seconds()))
+
+	rows, err := co.QueryStmts.TopLinksQuery.QueryContext(ctx, interval, scope, userID, workspaceDomain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]models.TopLink, 0, limit)
+	for rows.Next() {
+		var link models.TopLink
+		err = rows.Scan(&link.ShortURL, &link.OriginalURL, &link.Hits, &link.WindowHits, &link.PreviousWindowHits)
+		if err != nil {
+			return nil, err
+		}
+
+		link.Velocity = float64(link.WindowHits) / window.Hours()
+		link.Growth = float64(link.WindowHits-link.PreviousWindowHits) / float64(max(link.PreviousWindowHits, 1))
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// rollupLeaseKey redis key of the lease electing the replica rolling up the hits.
+const rollupLeaseKey = "lease:hits-rollup"
+
+// rollupOverlapDays are rolled up again on every pass, covering the hits
+// committed late for the days already rolled up.
+const rollupOverlapDays = 1
+
+// initRollupLease helps to elect the replica rolling up the hits.
+// Every replica is its own leader when the cache is not backed by redis.
+func (co *Core) initRollupLease() leader.Lease {
+	if co.rdb == nil {
+		return leader.LocalLease{}
+	}
+	// The leader renews the lease on every pass. Missing a few passes hands it over.
+	return leader.NewRedisLease(co.rdb, rollupLeaseKey, 3*co.RollupInterval)
+}
+
+// RollupUrlHits helps to aggregate the raw hits (urls_hit_count) into the daily
+// per link summaries (url_daily_stats) and purges the raw hits older than the
+// configured retention. This is an entire blocking infinite loop.
+//
+// Only the replica holding the rollup lease rolls up, every RollupInterval.
+// Only the completed days (UTC) are rolled up. The raw hits are purged by entire
+// days, and only once they have been rolled up, so re-aggregating a retained day
+// is always safe.
+//
+// caller must run it in separate go routine.
+func (co *Core) RollupUrlHits() {
+	backoff := breaker.Backoff{Min: 1 * time.Second, Max: co.RollupInterval}
+
+	for {
+		leading, err := co.rollupLease.Acquire(context.Background())
+		if err != nil {
+			co.Lo.Error("unable to acquire the hits rollup lease", "error", err)
+		}
+		if !leading {
+			// Another replica is rolling up.
+			time.Sleep(co.RollupInterval)
+			continue
+		}
+
+		ctx, span := tracing.Tracer().Start(context.Background(), "RollupUrlHits")
+		err = co.rollupUrlHits(ctx)
+		metrics.BackgroundJobRuns.WithLabelValues("hits_rollup", metrics.Outcome(err)).Inc()
+		span.End()
+		if err != nil {
+			delay := backoff.Next()
+			co.Lo.Error("unable to rollup the url hits", "error", err, "retryIn", delay)
+			time.Sleep(delay)
+			continue
+		}
+
+		backoff.Reset()
+		time.Sleep(co.RollupInterval)
+	}
+}
+
+// rollupUrlHits runs a single pass of the rollup, then purges the raw hits.
+//
+// The pass resumes from the last day rolled up, stored with the rollups
+// (max day of url_daily_stats), minus rollupOverlapDays. The first pass covers
+// every retained raw hit.
+func (co *Core) rollupUrlHits(ctx context.Context) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var lastDay sql.NullTime
+	if err := co.QueryStmts.GetRollupWatermarkQuery.QueryRowContext(ctx).Scan(&lastDay); err != nil {
+		return err
+	}
+	var from time.Time
+	if lastDay.Valid {
+		from = lastDay.Time.UTC().AddDate(0, 0, -rollupOverlapDays)
+	}
+
+	// The days are passed as UTC dates, whatever the time zone of the session.
+	_, err := co.QueryStmts.RollupDailyUrlHitsQuery.ExecContext(ctx, from.Format(time.DateOnly), today.Format(time.DateOnly))
+	if err != nil {
+		return err
+	}
+	co.Lo.Info("url hits have been rolled up", "from", from, "till", today)
+
+	retainFrom := today.AddDate(0, 0, -co.RawHitsRetentionDays)
+	res, err := co.QueryStmts.PurgeRawUrlHitsQuery.ExecContext(ctx, retainFrom.Format(time.DateOnly))
+	if err != nil {
+		return fmt.Errorf("unable to purge the raw url hits: %w", err)
+	}
+	if purged, _ := res.RowsAffected(); purged > 0 {
+		co.Lo.Info("raw url hits have been purged", "before", retainFrom, "purged", purged)
+	}
+	return nil
+}
+
+// GetUrlDailyStats helps to fetch the daily hits of the short url since the given day.
+//
+// The completed days are served from the rollups, and the days not rolled up yet
+// (today, or the ones the rollup job has not caught up with) from the raw hits.
+func (co *Core) GetUrlDailyStats(ctx context.Context, shortUrl string, since time.Time) ([]models.DailyStat, error) {
+	rows, err := co.QueryStmts.GetUrlDailyStatsQuery.QueryContext(ctx, shortUrl, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]models.DailyStat, 0)
+	for rows.Next() {
+		var stat models.DailyStat
+		err = rows.Scan(&stat.Day, &stat.Hits, &stat.BotHits)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
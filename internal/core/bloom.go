@@ -0,0 +1,610 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/bloom"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/cache"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/leader"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/tracing"
+)
+
+// bloomSnapshotKey redis key of the bloom filter snapshot.
+const bloomSnapshotKey = "bloom:snapshot"
+
+// bloomSnapshotLeaseKey redis key of the lease electing the replica saving the bloom filter snapshot.
+const bloomSnapshotLeaseKey = "lease:bloom-snapshot"
+
+// bloomCatchUpOverlap ids below the high-water mark are re-scanned on every
+// catch-up, covering the short urls of the transactions committed out of order.
+const bloomCatchUpOverlap = 1000
+
+// bloomSnapshotMagic prefixes the snapshots, versioning their encoding: the
+// bloomSync (watermarks, added and removed ids), followed by the bloom filter.
+var bloomSnapshotMagic = []byte("BSN2")
+
+// bloomSnapshotTimeout bounds the reads and writes of the redis snapshots,
+// tens of MB far above the timeout of the cache client.
+const bloomSnapshotTimeout = 30 * time.Second
+
+// bloomSync holds the progress of the bloom filter over url_mappings.
+// Guarded by the bloomMu of the Core, for the reads as well.
+//
+// The bloom filter holds every short url with an id up to highWater expiring
+// after sweptTill, plus the short urls created by the replica itself.
+type bloomSync struct {
+	highWater int64
+	sweptTill time.Time
+	// Ids of the short urls added above highWater - bloomCatchUpOverlap, so a
+	// counting filter never counts a short url twice.
+	added map[int64]struct{}
+	// Ids of the expired short urls removed, by their expiry, until sweptTill
+	// passes it. So a short url reclaimed ahead of its sweep is removed once.
+	removed map[int64]time.Time
+	// Generation of the latest rebuild of the redis bloom filter caught up.
+	rebuildGeneration string
+}
+
+// newBloomSync helps to create the progress of an empty bloom filter.
+func newBloomSync(sweptTill time.Time) bloomSync {
+	return bloomSync{
+		sweptTill: sweptTill,
+		added:     make(map[int64]struct{}),
+		removed:   make(map[int64]time.Time),
+	}
+}
+
+// MarshalBinary encodes the watermarks with the added and removed ids, so a
+// restored counting filter never counts nor removes a short url twice.
+func (s *bloomSync) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(bloomSnapshotMagic)+24+8*len(s.added)+16*len(s.removed))
+	data = append(data, bloomSnapshotMagic...)
+	data = binary.BigEndian.AppendUint64(data, uint64(s.highWater))
+	data = binary.BigEndian.AppendUint64(data, uint64(s.sweptTill.UnixNano()))
+
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.added)))
+	for id := range s.added {
+		data = binary.BigEndian.AppendUint64(data, uint64(id))
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.removed)))
+	for id, expirationAt := range s.removed {
+		data = binary.BigEndian.AppendUint64(data, uint64(id))
+		data = binary.BigEndian.AppendUint64(data, uint64(expirationAt.UnixNano()))
+	}
+	return data, nil
+}
+
+// unmarshalBloomSync decodes the bloomSync of the snapshot.
+// Returns the rest of the snapshot, the bloom filter.
+func unmarshalBloomSync(data []byte) (bloomSync, []byte, error) {
+	errInvalid := errors.New("invalid bloom filter snapshot")
+	header := len(bloomSnapshotMagic) + 20
+	if len(data) < header || string(data[:len(bloomSnapshotMagic)]) != string(bloomSnapshotMagic) {
+		return bloomSync{}, nil, errInvalid
+	}
+	data = data[len(bloomSnapshotMagic):]
+
+	s := newBloomSync(time.Unix(0, int64(binary.BigEndian.Uint64(data[8:16]))))
+	s.highWater = int64(binary.BigEndian.Uint64(data[:8]))
+
+	count := int(binary.BigEndian.Uint32(data[16:20]))
+	data = data[20:]
+	if len(data) < 8*count+4 {
+		return bloomSync{}, nil, errInvalid
+	}
+	for range count {
+		s.added[int64(binary.BigEndian.Uint64(data))] = struct{}{}
+		data = data[8:]
+	}
+
+	count = int(binary.BigEndian.Uint32(data))
+	data = data[4:]
+	if len(data) < 16*count {
+		return bloomSync{}, nil, errInvalid
+	}
+	for range count {
+		s.removed[int64(binary.BigEndian.Uint64(data))] = time.Unix(0, int64(binary.BigEndian.Uint64(data[8:])))
+		data = data[16:]
+	}
+	return s, data, nil
+}
+
+// bloomAlias is a short url with its url_mappings id.
+type bloomAlias struct {
+	id       int64
+	shortUrl string
+}
+
+// bloomScanBatch is the number of short urls added into the bloom filter at once.
+const bloomScanBatch = 1000
+
+// add adds the short urls into the filter in a single batch, skipping the ones already added.
+func (s *bloomSync) add(filter bloom.Filter, aliases ...bloomAlias) {
+	shortUrls := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if _, found := s.added[alias.id]; found {
+			continue
+		}
+		s.added[alias.id] = struct{}{}
+		shortUrls = append(shortUrls, alias.shortUrl)
+	}
+	bloom.AddMany(filter, shortUrls)
+}
+
+// remove removes the expired short url from the filter, when held and not removed yet.
+func (s *bloomSync) remove(filter bloom.DeletableFilter, alias bloomAlias, expirationAt time.Time) {
+	if !expirationAt.After(s.sweptTill) {
+		// Swept already, or never added.
+		return
+	}
+	if _, added := s.added[alias.id]; alias.id > s.highWater && !added {
+		// Not caught up yet, the catch-up skips it as expired by then.
+		return
+	}
+	if _, removed := s.removed[alias.id]; removed {
+		return
+	}
+	s.removed[alias.id] = expirationAt
+	filter.Remove(alias.shortUrl)
+}
+
+// sweep moves the sweep watermark, dropping the removed ids it has passed.
+func (s *bloomSync) sweep(sweptTill time.Time) {
+	s.sweptTill = sweptTill
+	for id, expirationAt := range s.removed {
+		if !expirationAt.After(sweptTill) {
+			delete(s.removed, id)
+		}
+	}
+}
+
+// caughtUp reports whether the id has been added by a catch-up already, and
+// forgotten since: the ids up to highWater - bloomCatchUpOverlap.
+func (s *bloomSync) caughtUp(id int64) bool {
+	_, added := s.added[id]
+	return !added && id <= s.highWater-bloomCatchUpOverlap
+}
+
+// forget drops the ids not re-scanned by the next catch-ups anymore.
+func (s *bloomSync) forget(highWater int64) {
+	for id := range s.added {
+		if id <= highWater-bloomCatchUpOverlap {
+			delete(s.added, id)
+		}
+	}
+}
+
+// newBloomFilter helps to create a new bloom filter of the configured type,
+// sized for the expected number of items. The scalable filter chains standard
+// filters, it can not remove the keys anyway.
+func (co *Core) newBloomFilter(expectedItems uint64) bloom.Filter {
+	if co.BloomScalable {
+		return bloom.NewScalableBloomFilter(bloom.FilterStandard, expectedItems, co.BloomFalsePositiveRate)
+	}
+	return bloom.NewFilter(co.BloomFilterType, expectedItems, co.BloomFalsePositiveRate)
+}
+
+// initBloomSnapshots helps to attach the configured store of the bloom filter snapshots,
+// with the lease electing the replica saving them. Returns a nil store when disabled.
+func (co *Core) initBloomSnapshots() (bloom.SnapshotStore, leader.Lease) {
+	switch co.BloomSnapshot {
+	case bloom.SnapshotFile:
+		co.Lo.Info("bloom filter snapshots initialized", "store", co.BloomSnapshot, "path", co.BloomSnapshotPath)
+		return bloom.NewFileSnapshotStore(co.BloomSnapshotPath), leader.LocalLease{}
+	case bloom.SnapshotRedis:
+		if co.rdb == nil {
+			co.Lo.Warn("redis bloom filter snapshots require the redis cache backend, snapshots disabled")
+			return nil, nil
+		}
+		co.Lo.Info("bloom filter snapshots initialized", "store", co.BloomSnapshot)
+		// A dedicated client, the snapshots do not fit in the timeout of the cache one.
+		opts := co.redisOpts
+		opts.Timeout = bloomSnapshotTimeout
+		rdb := cache.NewRedisClient(opts)
+		rdb.AddHook(tracing.RedisHook{})
+		// Every replica holds the same aliases, a single one saves the shared snapshot.
+		return bloom.NewRedisSnapshotStore(rdb, bloomSnapshotKey),
+			leader.NewRedisLease(co.rdb, bloomSnapshotLeaseKey, 3*co.BloomSnapshotInterval)
+	}
+	return nil, nil
+}
+
+// BloomFilterLoaded reports whether the bloom filter knows every existing short url.
+func (co *Core) BloomFilterLoaded() bool {
+	return co.bloomLoaded.Load()
+}
+
+// addToBloomFilter adds the short urls into the bloom filter, unless already added.
+func (co *Core) addToBloomFilter(aliases ...bloomAlias) {
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	co.bloomSync.add(co.BloomFilter, aliases...)
+	if co.bloomRebuilding {
+		// Replayed into the rebuilt filter.
+		co.bloomRebuildLog = append(co.bloomRebuildLog, aliases...)
+	}
+}
+
+// addBroadcastToBloomFilter adds the short url broadcast by another replica
+// into the bloom filter, unless added already. A broadcast delivered once the
+// catch-ups have added and forgotten its id is skipped, a counting filter
+// would count it twice and never remove it.
+func (co *Core) addBroadcastToBloomFilter(alias bloomAlias) {
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	if co.bloomSync.caughtUp(alias.id) {
+		return
+	}
+	co.bloomSync.add(co.BloomFilter, alias)
+	if co.bloomRebuilding {
+		co.bloomRebuildLog = append(co.bloomRebuildLog, alias)
+	}
+}
+
+// removeReclaimedFromBloomFilter removes the expired short url, whose alias
+// has just been reclaimed, from the bloom filter when it supports the removals.
+// Its row does not hold the alias anymore, the sweep skips it.
+func (co *Core) removeReclaimedFromBloomFilter(alias bloomAlias, expirationAt time.Time) {
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	if filter, deletable := co.BloomFilter.Load().(bloom.DeletableFilter); deletable {
+		co.bloomSync.remove(filter, alias, expirationAt)
+	}
+}
+
+// catchUpBloomAliases adds the short urls caught up into the bloom filter,
+// then moves the high-water mark to the last one.
+//
+// The mark moves batch by batch, along with the ids forgotten: a catch-up
+// failing midway resumes from there, never re-scanning a forgotten id.
+func (co *Core) catchUpBloomAliases(aliases []bloomAlias) {
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	co.bloomSync.add(co.BloomFilter, aliases...)
+	if co.bloomRebuilding {
+		co.bloomRebuildLog = append(co.bloomRebuildLog, aliases...)
+	}
+	co.bloomSync.highWater = max(co.bloomSync.highWater, aliases[len(aliases)-1].id)
+	// Bound the ids remembered by the initial preload.
+	co.bloomSync.forget(co.bloomSync.highWater)
+}
+
+// RequestBloomRebuild helps to request a rebuild of the bloom filter from the
+// database, performed by the PreloadBloomFilter loop.
+// Returns false when a rebuild is already pending.
+func (co *Core) RequestBloomRebuild() bool {
+	select {
+	case co.bloomRebuild <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// PreloadBloomFilter helps to preload the bloom filter with all the existing short urls.
+// This is done to improve the performance of the CustomAliasAvailabilityHandler.
+//
+// The bloom filter is restored from the latest snapshot (see LoadBloomSnapshot)
+// when available, and only the short urls created past its high-water mark are
+// read from the database. Retries with an exponential backoff until the bloom
+// filter gets loaded.
+//
+// Once loaded, the short urls created by the other replicas are caught up every
+// BloomSyncInterval, the expired ones removed when the filter supports it, and
+// a snapshot is saved every BloomSnapshotInterval. The rebuilds requested by
+// RequestBloomRebuild are performed in between.
+// This is an entire blocking infinite loop.
+//
+// caller must run it in separate go routine. As the alias will be huge distributed.
+func (co *Core) PreloadBloomFilter() {
+	backoff := breaker.Backoff{Min: 1 * time.Second, Max: 1 * time.Minute}
+
+	for {
+		err := co.catchUpBloomFilter()
+		metrics.BackgroundJobRuns.WithLabelValues("bloom_preload", metrics.Outcome(err)).Inc()
+		if err == nil {
+			break
+		}
+
+		delay := backoff.Next()
+		co.Lo.Error("unable to preload the bloom filter", "error", err, "retryIn", delay)
+		time.Sleep(delay)
+	}
+
+	co.bloomLoaded.Store(true)
+	co.bloomMu.Lock()
+	highWater := co.bloomSync.highWater
+	co.bloomMu.Unlock()
+	co.Lo.Info("bloom filter has been preloaded", "highWater", highWater, "info", co.BloomFilter.Info())
+
+	var savedAt time.Time
+	for {
+		select {
+		case <-co.bloomRebuild:
+			err := co.rebuildBloomFilter()
+			metrics.BackgroundJobRuns.WithLabelValues("bloom_rebuild", metrics.Outcome(err)).Inc()
+			if err != nil {
+				co.Lo.Error("unable to rebuild the bloom filter", "error", err)
+				continue
+			}
+			// Snapshot the rebuilt filter right away.
+			savedAt = time.Time{}
+		case <-time.After(co.BloomSyncInterval):
+		}
+
+		err := co.catchUpBloomFilter()
+		if err == nil {
+			err = co.sweepBloomFilter()
+		}
+		metrics.BackgroundJobRuns.WithLabelValues("bloom_sync", metrics.Outcome(err)).Inc()
+		if err != nil {
+			co.Lo.Error("unable to sync the bloom filter", "error", err)
+			continue
+		}
+
+		if co.bloomSnapshots == nil || time.Since(savedAt) < co.BloomSnapshotInterval {
+			continue
+		}
+		err = co.saveBloomSnapshot()
+		metrics.BackgroundJobRuns.WithLabelValues("bloom_snapshot", metrics.Outcome(err)).Inc()
+		if err != nil {
+			co.Lo.Error("unable to save the bloom filter snapshot", "error", err)
+			continue
+		}
+		savedAt = time.Now()
+	}
+}
+
+// catchUpBloomFilter adds the short urls created past the high-water mark into the bloom filter.
+//
+// The short urls expiring after the sweep watermark are added even if already
+// expired, the next sweep removes them. So every short url removed by the
+// sweeps has been added before.
+func (co *Core) catchUpBloomFilter() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "PreloadBloomFilter")
+	defer span.End()
+
+	if co.BloomSharing == BloomSharingRedis {
+		if err := co.rewindToSharedRebuild(ctx); err != nil {
+			co.Lo.Error("unable to check the rebuilds of the redis bloom filter", "error", err)
+		}
+	}
+
+	co.bloomMu.Lock()
+	highWater, sweptTill := co.bloomSync.highWater, co.bloomSync.sweptTill
+	co.bloomMu.Unlock()
+
+	since := max(highWater-bloomCatchUpOverlap, 0)
+	err := co.scanBloomAliases(ctx, since, sweptTill, co.catchUpBloomAliases)
+	if err != nil {
+		return err
+	}
+
+	co.bloomMu.Lock()
+	highWater = co.bloomSync.highWater
+	co.bloomMu.Unlock()
+
+	if co.BloomSharing == BloomSharingRedis {
+		// The next replicas to boot resume from there.
+		if err := co.storeSharedHighWater(ctx, highWater); err != nil {
+			co.Lo.Error("unable to store the bloom filter high-water mark", "error", err)
+		}
+	}
+	return nil
+}
+
+// scanBloomAliases streams the short urls with an id above since, expiring
+// after sweptTill, in batches of bloomScanBatch ordered by id.
+func (co *Core) scanBloomAliases(ctx context.Context, since int64, sweptTill time.Time, fn func(aliases []bloomAlias)) error {
+	rows, err := co.QueryStmts.GetShortUrlAliasesSinceQuery.QueryContext(ctx, since, sweptTill)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]bloomAlias, 0, bloomScanBatch)
+	for rows.Next() {
+		var alias bloomAlias
+		if err = rows.Scan(&alias.id, &alias.shortUrl); err != nil {
+			return err
+		}
+		batch = append(batch, alias)
+		if len(batch) == bloomScanBatch {
+			fn(batch)
+			batch = batch[:0]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		fn(batch)
+	}
+	return nil
+}
+
+// rebuildBloomFilter rebuilds the bloom filter from scratch, sized for the
+// current number of short urls, then swaps it for the current one. Drops the
+// expired aliases a standard filter holds and resets a degraded filter.
+//
+// The short urls created while rebuilding are replayed into the rebuilt filter.
+func (co *Core) rebuildBloomFilter() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "RebuildBloomFilter")
+	defer span.End()
+
+	var activeShortUrls uint64
+	err := co.QueryStmts.CountActiveShortUrlsQuery.QueryRowContext(ctx).Scan(&activeShortUrls)
+	if err != nil {
+		return err
+	}
+
+	co.bloomMu.Lock()
+	co.bloomRebuilding = true
+	co.bloomMu.Unlock()
+
+	filter := co.newBloomFilter(max(co.BloomExpectedItems, 2*activeShortUrls))
+	if co.BloomSharing == BloomSharingRedis {
+		// Rebuilt aside, then moved over the shared bitmap.
+		filter = co.newRedisBloomFilter(bloomRebuildBitsKey)
+	}
+	rebuilt := newBloomSync(time.Now())
+	scanned := 0
+	err = co.scanBloomAliases(ctx, 0, rebuilt.sweptTill, func(aliases []bloomAlias) {
+		rebuilt.add(filter, aliases...)
+		rebuilt.highWater = max(rebuilt.highWater, aliases[len(aliases)-1].id)
+		rebuilt.forget(rebuilt.highWater)
+		scanned += len(aliases)
+	})
+
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	co.bloomRebuilding = false
+	rebuildLog := co.bloomRebuildLog
+	co.bloomRebuildLog = nil
+	if err != nil {
+		return err
+	}
+
+	rebuilt.add(filter, rebuildLog...)
+	rebuilt.forget(rebuilt.highWater)
+
+	if rebuiltBits, ok := filter.(*bloom.RedisBloomFilter); ok {
+		if err = rebuiltBits.RenameTo(ctx, co.BloomFilter.Load().(*bloom.RedisBloomFilter)); err != nil {
+			return err
+		}
+		// The other replicas catch up again from there, the aliases they
+		// added meanwhile went into the replaced bitmap.
+		if rebuilt.rebuildGeneration, err = co.storeSharedRebuild(ctx, rebuilt.highWater); err != nil {
+			return err
+		}
+	}
+
+	co.BloomFilter.Swap(filter)
+	co.bloomSync = rebuilt
+	co.Lo.Info("bloom filter has been rebuilt", "shortUrls", scanned, "info", filter.Info())
+	return nil
+}
+
+// sweepBloomFilter removes the short urls expired since the previous sweep from
+// the bloom filter, when it supports the removals. Then moves the sweep watermark.
+//
+// Only the short urls up to the high-water mark are removed, the other ones
+// have not been caught up yet.
+func (co *Core) sweepBloomFilter() error {
+	co.bloomMu.Lock()
+	highWater, previousSweptTill := co.bloomSync.highWater, co.bloomSync.sweptTill
+	co.bloomMu.Unlock()
+
+	sweptTill := time.Now()
+	if !sweptTill.After(previousSweptTill) {
+		return nil
+	}
+
+	filter, deletable := co.BloomFilter.Load().(bloom.DeletableFilter)
+	if !deletable {
+		co.bloomMu.Lock()
+		co.bloomSync.sweep(sweptTill)
+		co.bloomMu.Unlock()
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "SweepBloomFilter")
+	defer span.End()
+
+	rows, err := co.QueryStmts.ExpiredShortUrlAliasesQuery.QueryContext(ctx, previousSweptTill, sweptTill, highWater)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	removed := 0
+	for rows.Next() {
+		var alias bloomAlias
+		var expirationAt time.Time
+		if err = rows.Scan(&alias.id, &alias.shortUrl, &expirationAt); err != nil {
+			return err
+		}
+		// Reclaimed short urls might have been removed already.
+		co.bloomMu.Lock()
+		co.bloomSync.remove(filter, alias, expirationAt)
+		co.bloomMu.Unlock()
+		removed++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if removed > 0 {
+		co.Lo.Info("expired aliases have been removed from the bloom filter", "count", removed, "till", sweptTill)
+	}
+	co.bloomMu.Lock()
+	co.bloomSync.sweep(sweptTill)
+	co.bloomMu.Unlock()
+	return nil
+}
+
+// LoadBloomSnapshot restores the bloom filter and its progress from the latest snapshot.
+// Must be called before the bloom filter gets used.
+func (co *Core) LoadBloomSnapshot() error {
+	if co.bloomSnapshots == nil {
+		return bloom.ErrNoSnapshot
+	}
+
+	data, err := co.bloomSnapshots.Load(context.Background())
+	if err != nil {
+		return err
+	}
+	restored, filter, err := unmarshalBloomSync(data)
+	if err != nil {
+		return err
+	}
+
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	if err = co.BloomFilter.UnmarshalBinary(filter); err != nil {
+		return err
+	}
+	co.bloomSync = restored
+
+	co.Lo.Info("bloom filter snapshot has been loaded", "highWater", restored.highWater, "sweptTill", restored.sweptTill)
+	return nil
+}
+
+// saveBloomSnapshot saves the bloom filter with its progress, when the
+// replica holds the snapshot lease.
+//
+// Both are captured under the bloomMu, the adds and removals wait meanwhile.
+// So the snapshot holds exactly the short urls its progress tells.
+func (co *Core) saveBloomSnapshot() error {
+	ctx := context.Background()
+
+	leading, err := co.bloomSnapshotLease.Acquire(ctx)
+	if err != nil || !leading {
+		return err
+	}
+
+	co.bloomMu.Lock()
+	data, err := co.bloomSync.MarshalBinary()
+	var filter []byte
+	if err == nil {
+		filter, err = co.BloomFilter.MarshalBinary()
+	}
+	co.bloomMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return co.bloomSnapshots.Save(ctx, append(data, filter...))
+}
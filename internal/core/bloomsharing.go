@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/bloom"
+)
+
+// Sharing modes of the bloom filter across the replicas.
+//
+//   - local: every replica holds its own filter, catching up the aliases
+//     created by the other replicas every BloomSyncInterval.
+//   - pubsub: as local, plus the aliases created are broadcast to every
+//     replica through redis pub/sub as soon as created.
+//   - redis: a single filter stored in a redis bitmap, shared by every replica.
+const (
+	BloomSharingLocal  = "local"
+	BloomSharingPubSub = "pubsub"
+	BloomSharingRedis  = "redis"
+)
+
+// Redis keys of the shared bloom filter.
+const (
+	bloomBitsKey        = "bloom:bits"
+	bloomRebuildBitsKey = "bloom:bits:rebuild"
+	bloomHighWaterKey   = "bloom:high-water"
+	// Latest rebuild of the shared bitmap, as "generation:highWater".
+	bloomRebuiltKey = "bloom:rebuilt"
+)
+
+// bloomAddsChannel redis pub/sub channel broadcasting the aliases created, as "id:shortUrl".
+const bloomAddsChannel = "bloom:add"
+
+// storeHighWaterScript moves the shared high-water mark forward only.
+var storeHighWaterScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > current then
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 0`)
+
+// initBloomFilter helps to create the bloom filter of the configured sharing mode.
+// Falls back to the local mode when the cache is not backed by redis.
+func (co *Core) initBloomFilter() bloom.Filter {
+	if co.BloomSharing != BloomSharingLocal && co.rdb == nil {
+		co.Lo.Warn("bloom filter sharing requires the redis cache backend, falling back to local", "sharing", co.BloomSharing)
+		co.BloomSharing = BloomSharingLocal
+	}
+
+	if co.BloomScalable && co.BloomFilterType == bloom.FilterCounting && co.BloomSharing != BloomSharingRedis {
+		co.Lo.Warn("the scalable bloom filter does not support the removals, the expired aliases stay in it")
+	}
+
+	co.Lo.Info("bloom filter initialized", "sharing", co.BloomSharing)
+	if co.BloomSharing == BloomSharingRedis {
+		return co.newRedisBloomFilter(bloomBitsKey)
+	}
+	return co.newBloomFilter(co.BloomExpectedItems)
+}
+
+// newRedisBloomFilter helps to create a bloom filter stored in the redis bitmap.
+// Always sized for BloomExpectedItems, so every replica agrees on the size.
+func (co *Core) newRedisBloomFilter(keyPrefix string) *bloom.RedisBloomFilter {
+	return bloom.NewRedisBloomFilter(co.rdb, keyPrefix, co.BloomExpectedItems, co.BloomFalsePositiveRate, func(err error) {
+		co.Lo.Error("unable to reach the redis bloom filter", "error", err)
+	})
+}
+
+// resumeSharedBloomFilter restores the high-water mark of the redis bloom filter,
+// so only the short urls created past it are caught up on boot.
+func (co *Core) resumeSharedBloomFilter() {
+	highWater, err := co.rdb.Get(context.Background(), bloomHighWaterKey).Int64()
+	if err != nil && err != redis.Nil {
+		co.Lo.Error("unable to load the bloom filter high-water mark, preloading from the database", "error", err)
+		return
+	}
+
+	// The rebuilds before the boot are part of the bitmap already.
+	generation, _, err := co.loadSharedRebuild(context.Background())
+
+	co.bloomMu.Lock()
+	co.bloomSync.highWater = highWater
+	if err == nil {
+		co.bloomSync.rebuildGeneration = generation
+	}
+	co.bloomMu.Unlock()
+	co.Lo.Info("redis bloom filter has been resumed", "highWater", highWater)
+}
+
+// storeSharedHighWater records the high-water mark of the redis bloom filter.
+// Moves it forward only.
+func (co *Core) storeSharedHighWater(ctx context.Context, highWater int64) error {
+	return storeHighWaterScript.Run(ctx, co.rdb, []string{bloomHighWaterKey}, highWater).Err()
+}
+
+// storeSharedRebuild records the rebuild of the redis bloom filter up to the
+// high-water mark, and resets the shared high-water mark to it.
+// Returns the generation of the rebuild.
+func (co *Core) storeSharedRebuild(ctx context.Context, highWater int64) (string, error) {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err := co.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, bloomRebuiltKey, fmt.Sprintf("%s:%d", generation, highWater), 0)
+		pipe.Set(ctx, bloomHighWaterKey, highWater, 0)
+		return nil
+	})
+	return generation, err
+}
+
+// loadSharedRebuild returns the generation and the high-water mark of the
+// latest rebuild of the redis bloom filter. Returns redis.Nil when never rebuilt.
+func (co *Core) loadSharedRebuild(ctx context.Context) (string, int64, error) {
+	value, err := co.rdb.Get(ctx, bloomRebuiltKey).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	generation, rawHighWater, _ := strings.Cut(value, ":")
+	highWater, err := strconv.ParseInt(rawHighWater, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid bloom filter rebuild: %q", value)
+	}
+	return generation, highWater, nil
+}
+
+// rewindToSharedRebuild moves the high-water mark back to the one of the
+// latest rebuild of the redis bloom filter, when rebuilt by another replica.
+//
+// The aliases the replica added while the other one was rebuilding went into
+// the replaced bitmap, so they get caught up again into the rebuilt one.
+func (co *Core) rewindToSharedRebuild(ctx context.Context) error {
+	generation, highWater, err := co.loadSharedRebuild(ctx)
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	co.bloomMu.Lock()
+	defer co.bloomMu.Unlock()
+
+	if generation == co.bloomSync.rebuildGeneration {
+		return nil
+	}
+	co.bloomSync.highWater = min(co.bloomSync.highWater, highWater)
+	co.bloomSync.rebuildGeneration = generation
+
+	co.Lo.Info("redis bloom filter has been rebuilt by another replica, catching up again", "highWater", highWater)
+	return nil
+}
+
+// announceShortUrl broadcasts the alias created to the other replicas, in pubsub sharing mode.
+func (co *Core) announceShortUrl(ctx context.Context, alias bloomAlias) {
+	if co.BloomSharing != BloomSharingPubSub {
+		return
+	}
+	err := co.rdb.Publish(ctx, bloomAddsChannel, fmt.Sprintf("%d:%s", alias.id, alias.shortUrl)).Err()
+	if err != nil {
+		// Caught up by the other replicas within BloomSyncInterval anyway.
+		co.Lo.Error("unable to broadcast the alias", "shortUrl", alias.shortUrl, "error", err)
+	}
+}
+
+// ListenBloomAdds helps to add the aliases created by any replica into the bloom
+// filter as soon as broadcast. This is an entire blocking loop.
+//
+// caller must run it in separate go routine.
+func (co *Core) ListenBloomAdds() {
+	pubsub := co.rdb.Subscribe(context.Background(), bloomAddsChannel)
+	defer pubsub.Close()
+
+	// The go-redis pub/sub reconnects by itself on connection failures.
+	for msg := range pubsub.Channel() {
+		rawID, shortUrl, found := strings.Cut(msg.Payload, ":")
+		id, err := strconv.ParseInt(rawID, 10, 64)
+		if !found || err != nil {
+			co.Lo.Warn("invalid alias broadcast", "payload", msg.Payload)
+			continue
+		}
+		co.addBroadcastToBloomFilter(bloomAlias{id, shortUrl})
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
+)
+
+// hotKeys is the set of the short urls detected hot, with the in-process
+// pinned copies of the hottest ones.
+type hotKeys struct {
+	mu     sync.RWMutex
+	keys   map[string]*hotKey
+	pinned map[string]pinnedUrl
+}
+
+type hotKey struct {
+	promotedAt time.Time
+	// The promotion is refreshed past validTill, while the key is still hot.
+	validTill time.Time
+	promoting bool
+}
+
+type pinnedUrl struct {
+	originalUrl string
+	expiresAt   time.Time
+}
+
+func newHotKeys() *hotKeys {
+	return &hotKeys{
+		keys:   make(map[string]*hotKey),
+		pinned: make(map[string]pinnedUrl),
+	}
+}
+
+// findPinnedUrl helps to lookup the original url of a pinned hot short url.
+func (co *Core) findPinnedUrl(shortUrl string) (string, bool) {
+	co.hotKeys.mu.RLock()
+	defer co.hotKeys.mu.RUnlock()
+
+	pinned, found := co.hotKeys.pinned[shortUrl]
+	if !found || time.Now().After(pinned.expiresAt) {
+		return "", false
+	}
+	return pinned.originalUrl, true
+}
+
+// observeHit helps to count the hit of the resolved short url in the sketch.
+// The short url is promoted as soon as its recent hits cross HotKeyThreshold.
+func (co *Core) observeHit(shortUrl string) {
+	if co.HotKeyThreshold <= 0 {
+		return
+	}
+	if co.hitSketch.Add(shortUrl) < uint32(co.HotKeyThreshold) {
+		return
+	}
+
+	co.hotKeys.mu.RLock()
+	key, found := co.hotKeys.keys[shortUrl]
+	promoted := found && (key.promoting || time.Now().Before(key.validTill))
+	co.hotKeys.mu.RUnlock()
+	if promoted {
+		return
+	}
+
+	co.hotKeys.mu.Lock()
+	key, found = co.hotKeys.keys[shortUrl]
+	if !found {
+		key = &hotKey{}
+		co.hotKeys.keys[shortUrl] = key
+	}
+	if key.promoting {
+		co.hotKeys.mu.Unlock()
+		return
+	}
+	key.promoting = true
+	co.hotKeys.mu.Unlock()
+
+	go co.promoteHotKey(shortUrl)
+}
+
+// promoteHotKey helps to promote the hot short url into the cache, and into the
+// pinned in-process map when it is one of the PinnedHotKeys hottest.
+//
+// The short url is read from the database, so the promoted entries never
+// outlive the short url. The pinned copy lives at most HotKeyPinTTL.
+func (co *Core) promoteHotKey(shortUrl string) {
+	ctx := context.Background()
+
+	var originalUrl string
+	var expirationAt time.Time
+	var missing bool
+	err := co.dbBreaker.Do(func() error {
+		err := co.QueryStmts.GetShortUrlQuery.QueryRowContext(ctx, shortUrl).Scan(&originalUrl, &expirationAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			missing = true
+			return nil
+		}
+		return err
+	})
+	if missing {
+		err = ErrShortUrlNotFound
+	}
+	if err == nil {
+		err = co.CacheOriginalUrl(ctx, shortUrl, originalUrl, expirationAt)
+	}
+	metrics.BackgroundJobRuns.WithLabelValues("hot_key_promotion", metrics.Outcome(err)).Inc()
+
+	co.hotKeys.mu.Lock()
+	defer co.hotKeys.mu.Unlock()
+
+	key, found := co.hotKeys.keys[shortUrl]
+	if !found {
+		// Invalidated while promoting.
+		return
+	}
+	key.promoting = false
+	if err != nil {
+		co.Lo.Error("unable to promote the hot short url", "shortUrl", shortUrl, "error", err)
+		delete(co.hotKeys.keys, shortUrl)
+		return
+	}
+
+	now := time.Now()
+	key.promotedAt = now
+	key.validTill = now.Add(co.HotKeyPinTTL)
+	if expirationAt.Before(key.validTill) {
+		key.validTill = expirationAt
+	}
+	co.pinHotKey(shortUrl, pinnedUrl{originalUrl: originalUrl, expiresAt: key.validTill})
+
+	co.Lo.Info("[HOT_KEY] promoted", "shortUrl", shortUrl, "estimatedHits", co.hitSketch.Estimate(shortUrl))
+}
+
+// pinHotKey pins the short url when there is room left, or when it is hotter
+// than the coldest pinned one which it replaces. Caller must hold the lock.
+func (co *Core) pinHotKey(shortUrl string, pinned pinnedUrl) {
+	if _, found := co.hotKeys.pinned[shortUrl]; found || len(co.hotKeys.pinned) < co.PinnedHotKeys {
+		co.hotKeys.pinned[shortUrl] = pinned
+		return
+	}
+
+	coldest, coldestHits := "", co.hitSketch.Estimate(shortUrl)
+	for pinnedShortUrl := range co.hotKeys.pinned {
+		if hits := co.hitSketch.Estimate(pinnedShortUrl); hits < coldestHits {
+			coldest, coldestHits = pinnedShortUrl, hits
+		}
+	}
+	if len(coldest) > 0 {
+		delete(co.hotKeys.pinned, coldest)
+		co.hotKeys.pinned[shortUrl] = pinned
+	}
+}
+
+// forgetHotKey drops the short url from the hot set and the pinned map.
+// Must be called whenever a short url is edited or deleted.
+func (co *Core) forgetHotKey(shortUrl string) {
+	co.hotKeys.mu.Lock()
+	defer co.hotKeys.mu.Unlock()
+
+	delete(co.hotKeys.keys, shortUrl)
+	delete(co.hotKeys.pinned, shortUrl)
+}
+
+// DecayHotKeys helps to decay the hit counts of the sketch every HotKeyDecayInterval,
+// dropping the short urls which are not hot anymore. This is an entire blocking infinite loop.
+//
+// caller must run it in separate go routine.
+func (co *Core) DecayHotKeys() {
+	for {
+		time.Sleep(co.HotKeyDecayInterval)
+		co.hitSketch.Decay()
+
+		co.hotKeys.mu.Lock()
+		for shortUrl, key := range co.hotKeys.keys {
+			if !key.promoting && co.hitSketch.Estimate(shortUrl) < uint32(co.HotKeyThreshold) {
+				delete(co.hotKeys.keys, shortUrl)
+				delete(co.hotKeys.pinned, shortUrl)
+			}
+		}
+		co.hotKeys.mu.Unlock()
+	}
+}
+
+// GetHotKeys helps to list the current hot short urls, hottest first.
+func (co *Core) GetHotKeys() []models.HotKey {
+	co.hotKeys.mu.RLock()
+	defer co.hotKeys.mu.RUnlock()
+
+	hot := make([]models.HotKey, 0, len(co.hotKeys.keys))
+	for shortUrl, key := range co.hotKeys.keys {
+		if key.promotedAt.IsZero() {
+			// Still being promoted.
+			continue
+		}
+		_, pinned := co.hotKeys.pinned[shortUrl]
+		hot = append(hot, models.HotKey{
+			ShortURL:      shortUrl,
+			EstimatedHits: co.hitSketch.Estimate(shortUrl),
+			PromotedAt:    key.promotedAt,
+			Pinned:        pinned,
+		})
+	}
+
+	sort.Slice(hot, func(i, j int) bool {
+		return hot[i].EstimatedHits > hot[j].EstimatedHits
+	})
+	return hot
+}
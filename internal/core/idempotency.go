@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/tracing"
+)
+
+// idempotencyLockTimeout the request holding an idempotency key is considered
+// gone (crashed replica) after, and another request can take the key over.
+const idempotencyLockTimeout = 1 * time.Minute
+
+var (
+	// ErrIdempotencyKeyReused is returned when the idempotency key was used by another request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key has been used with another request")
+	// ErrIdempotencyKeyInProgress is returned when the request of the idempotency key is still running.
+	ErrIdempotencyKeyInProgress = errors.New("request with the idempotency key is still in progress")
+)
+
+// IdempotentResponse is the response recorded for an idempotency key, replayed to the retries.
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// ClaimIdempotencyKey helps to claim the idempotency key of the user for the request.
+//
+// Returns a nil response when claimed, the request must run then, followed by
+// SaveIdempotentResponse or ReleaseIdempotencyKey. Returns the recorded
+// response when the same request already ran with the key, to be replayed.
+//
+// Returns ErrIdempotencyKeyReused when the key was used by another request, and
+// ErrIdempotencyKeyInProgress when the request of the key is still running.
+// The keys expire after IdempotencyKeyTTL.
+func (co *Core) ClaimIdempotencyKey(ctx context.Context, userID int, key, requestHash string) (*IdempotentResponse, error) {
+	now := time.Now()
+	var claimedBy int
+	err := co.QueryStmts.ClaimIdempotencyKeyQuery.QueryRowContext(ctx,
+		userID,
+		key,
+		requestHash,
+		now.Add(-co.IdempotencyKeyTTL),
+		now.Add(-idempotencyLockTimeout),
+	).Scan(&claimedBy)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Already claimed, by the same request or another one.
+	var storedHash string
+	var status sql.NullInt64
+	var body sql.NullString
+	err = co.QueryStmts.GetIdempotencyKeyQuery.QueryRowContext(ctx, userID, key).Scan(&storedHash, &status, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Purged in between, the retry claims it.
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !status.Valid {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return &IdempotentResponse{Status: int(status.Int64), Body: []byte(body.String)}, nil
+}
+
+// SaveIdempotentResponse helps to record the response of the request holding the idempotency key.
+func (co *Core) SaveIdempotentResponse(ctx context.Context, userID int, key string, response IdempotentResponse) error {
+	_, err := co.QueryStmts.SaveIdempotentResponseQuery.ExecContext(ctx, userID, key, response.Status, string(response.Body))
+	return err
+}
+
+// ReleaseIdempotencyKey helps to give up the idempotency key without any response,
+// so the retries of the request can run again.
+func (co *Core) ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error {
+	_, err := co.QueryStmts.ReleaseIdempotencyKeyQuery.ExecContext(ctx, userID, key)
+	return err
+}
+
+// PurgeIdempotencyKeys helps to delete the expired idempotency keys every hour,
+// or every IdempotencyKeyTTL when shorter.
+// This is an entire blocking loop.
+//
+// caller must run it in separate go routine.
+func (co *Core) PurgeIdempotencyKeys() {
+	interval := min(co.IdempotencyKeyTTL, 1*time.Hour)
+
+	for {
+		ctx, span := tracing.Tracer().Start(context.Background(), "PurgeIdempotencyKeys")
+
+		expiredBefore := time.Now().Add(-co.IdempotencyKeyTTL)
+		res, err := co.QueryStmts.PurgeIdempotencyKeysQuery.ExecContext(ctx, expiredBefore)
+		if err != nil {
+			co.Lo.Error("unable to purge the idempotency keys", "error", err)
+		} else if purged, _ := res.RowsAffected(); purged > 0 {
+			co.Lo.Info("idempotency keys have been purged", "before", expiredBefore, "purged", purged)
+		}
+		metrics.BackgroundJobRuns.WithLabelValues("idempotency_purge", metrics.Outcome(err)).Inc()
+		span.End()
+
+		time.Sleep(interval)
+	}
+}
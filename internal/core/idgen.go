@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/idgen"
+)
+
+// initIDGenerator helps to create the generator of the ids of the short urls (v2).
+//
+// The sequence generator leases the blocks of ids from the postgres sequence,
+// whose increment is the size of the blocks. The snowflake generator needs no
+// sequence, but an own SNOWFLAKE_NODE_ID per replica.
+func (co *Core) initIDGenerator() (idgen.Generator, error) {
+	if co.IDGenerator == idgen.GeneratorSnowflake {
+		// A default node id would be shared by the replicas, generating the same ids.
+		if co.SnowflakeNodeID < 0 {
+			return nil, errors.New("snowflake ids require SNOWFLAKE_NODE_ID, unique per replica")
+		}
+		// The snowflake ids are 63 bits long, the permutation must hold them.
+		if co.ShortCodeIDBits < 63 {
+			return nil, fmt.Errorf("snowflake ids require SHORTCODE_ID_BITS of 63 or 64: %d", co.ShortCodeIDBits)
+		}
+		co.Lo.Info("id generator initialized", "type", idgen.GeneratorSnowflake, "node", co.SnowflakeNodeID)
+		return idgen.NewSnowflake(co.SnowflakeNodeID)
+	}
+
+	var blockSize int64
+	err := co.QueryStmts.GetIDBlockSizeQuery.QueryRowContext(context.Background()).Scan(&blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	co.Lo.Info("id generator initialized", "type", idgen.GeneratorSequence, "blockSize", blockSize)
+	return idgen.NewBlockAllocator(uint64(max(blockSize, 0)), co.leaseIDBlock)
+}
+
+// leaseIDBlock helps to lease a new block of ids from the postgres sequence.
+// Returns the first id of the block.
+func (co *Core) leaseIDBlock(ctx context.Context) (uint64, error) {
+	var start int64
+	err := co.dbBreaker.Do(func() error {
+		return co.QueryStmts.GetIncrementalIDQuery.QueryRowContext(ctx).Scan(&start)
+	})
+	if errors.Is(err, breaker.ErrOpen) {
+		return 0, ErrUnavailable
+	}
+	return uint64(start), err
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+)
+
+// Tiers a short url can be resolved from.
+const (
+	SourceHotKey     = "hot_key"
+	SourceLocalCache = "local_cache"
+	SourceCache      = "cache"
+	SourceDatabase   = "database"
+)
+
+// cacheInvalidationChannel redis pub/sub channel broadcasting the short urls
+// to drop from the in-process caches of every replica.
+const cacheInvalidationChannel = "cache:invalidate"
+
+// negativeCacheValue is cached in place of the original url of the short urls
+// confirmed missing. It can never be a valid url.
+const negativeCacheValue = "\x00missing"
+
+// resolveTimeout bounds a shared lookup of the backends, as it does not end
+// with the request which started it.
+const resolveTimeout = 5 * time.Second
+
+// ErrShortUrlNotFound is returned when the short url does not exist or has expired.
+var ErrShortUrlNotFound = errors.New("No url found for the given shorten url")
+
+// ErrShortUrlTaken is returned when creating a short url which already exists.
+var ErrShortUrlTaken = errors.New("short url is already taken")
+
+// ErrUnavailable is returned when the short url can not be resolved because
+// both the cache and the database are unavailable.
+var ErrUnavailable = errors.New("service is temporarily unavailable")
+
+// resolvedUrl is the outcome of resolving a short url from the backends.
+type resolvedUrl struct {
+	originalUrl string
+	source      string
+}
+
+// ResolveShortUrl helps to find the original url of the short url.
+//
+// Looks up the in-process cache, then redis, and falls back to the database on
+// a miss. The url found is written back into the tiers in front (read-through),
+// so the next redirects of the short url are served from the caches.
+//
+// Concurrent lookups of the same short url missing the in-process cache are
+// coalesced, so a burst on a freshly shared link costs a single redis lookup,
+// database query and cache fill.
+//
+// Unknown short urls are rejected by the bloom filter without any lookup, and
+// the short urls confirmed missing (unknown or expired) are cached as such for
+// NegativeCacheTTL, so scanners never reach the database twice for an alias.
+//
+// The hits of the resolved short urls are counted in a count-min sketch, and
+// the hot ones get promoted into the caches as soon as they cross the
+// HotKeyThreshold. The hottest few are pinned in-process, in front of every tier.
+//
+// Returns the original url with the tier which resolved it.
+func (co *Core) ResolveShortUrl(ctx context.Context, shortUrl string) (string, string, error) {
+	// Check the URL is one of the pinned hot short urls.
+	if originalUrl, found := co.findPinnedUrl(shortUrl); found {
+		metrics.CacheLookups.WithLabelValues("pinned", "hit").Inc()
+		co.observeHit(shortUrl)
+		return originalUrl, SourceHotKey, nil
+	}
+
+	// Check the URL is present in the in-process cache.
+	if originalUrl, found := co.localCache.Get(shortUrl); found {
+		metrics.CacheLookups.WithLabelValues("local", "hit").Inc()
+		co.observeHit(shortUrl)
+		return originalUrl, SourceLocalCache, nil
+	}
+	metrics.CacheLookups.WithLabelValues("local", "miss").Inc()
+
+	// Short circuit the definite misses, once the bloom filter knows every alias.
+	if co.BloomShortCircuit && co.bloomLoaded.Load() {
+		if !co.BloomFilter.Exists(shortUrl) {
+			metrics.CacheLookups.WithLabelValues("bloom", "miss").Inc()
+			return "", "", ErrShortUrlNotFound
+		}
+	}
+
+	resolved, err, coalesced := co.resolveGroup.Do(shortUrl, func() (resolvedUrl, error) {
+		// The lookup is shared, it must outlive the request which started it,
+		// but not hang the waiters forever.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resolveTimeout)
+		defer cancel()
+		return co.resolveFromBackends(ctx, shortUrl)
+	})
+	if coalesced {
+		metrics.CoalescedLookups.Inc()
+	}
+	if err == nil {
+		co.observeHit(shortUrl)
+	}
+
+	return resolved.originalUrl, resolved.source, err
+}
+
+// resolveFromBackends looks up the short url in redis, then in the database,
+// filling the caches on the way back.
+func (co *Core) resolveFromBackends(ctx context.Context, shortUrl string) (resolvedUrl, error) {
+	// Check the URL is present in cache.
+	originalUrl, ttl, err := co.FindOriginalUrlFromCache(ctx, shortUrl)
+	if errors.Is(err, ErrShortUrlNotFound) {
+		return resolvedUrl{}, err
+	}
+	if err == nil && len(originalUrl) > 0 {
+		co.Lo.Info("[CACHE_HIT]", "originalUrl", originalUrl, "shortUrl", shortUrl)
+		// The redis entry never outlives the short url, neither does the local one.
+		co.localCache.Set(shortUrl, originalUrl, time.Now().Add(ttl))
+		return resolvedUrl{originalUrl, SourceCache}, nil
+	}
+	co.Lo.Info("[CACHE_MISS]", "shortUrl", shortUrl)
+
+	// Get the original url from the database. A missing short url is not a failure.
+	var expirationAt time.Time
+	var missing bool
+	err = co.dbBreaker.Do(func() error {
+		err := co.QueryStmts.GetShortUrlQuery.QueryRowContext(ctx, shortUrl).Scan(&originalUrl, &expirationAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			missing = true
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, breaker.ErrOpen) {
+		return resolvedUrl{}, ErrUnavailable
+	}
+	if missing || (err == nil && len(originalUrl) == 0) {
+		// Remember the miss for a while. Dropped as soon as the alias gets created.
+		if err := co.Cache.Set(ctx, shortUrl, negativeCacheValue, co.NegativeCacheTTL); err != nil && !errors.Is(err, breaker.ErrOpen) {
+			co.Lo.Error("unable to cache the missing short url", "shortUrl", shortUrl, "error", err)
+		}
+		return resolvedUrl{}, ErrShortUrlNotFound
+	}
+	if err != nil {
+		return resolvedUrl{}, err
+	}
+
+	// Populate the cache on the miss. A failure here must not fail the redirect.
+	if err := co.CacheOriginalUrl(ctx, shortUrl, originalUrl, expirationAt); err != nil && !errors.Is(err, breaker.ErrOpen) {
+		co.Lo.Error("unable to cache the short url", "shortUrl", shortUrl, "error", err)
+	}
+
+	return resolvedUrl{originalUrl, SourceDatabase}, nil
+}
+
+// CacheOriginalUrl helps to cache the original url of the short url.
+//
+// The entry lives for the configured max TTL, but never past the expiry of
+// the short url. So an expired short url can never be served from the cache.
+func (co *Core) CacheOriginalUrl(ctx context.Context, shortUrl, originalUrl string, expirationAt time.Time) error {
+	ttl := co.cacheTTL(expirationAt)
+	if ttl <= 0 {
+		// Already expired, nothing to cache.
+		return nil
+	}
+	co.localCache.Set(shortUrl, originalUrl, expirationAt)
+	return co.Cache.Set(ctx, shortUrl, originalUrl, ttl)
+}
+
+// InvalidateShortUrl helps to drop the short url from every cache tier.
+// Must be called whenever a short url is edited or deleted.
+//
+// The in-process caches of the other replicas are invalidated through redis
+// pub/sub (redis cache backend only). When the broadcast is missed, their
+// entries still expire within LocalCacheTTL.
+func (co *Core) InvalidateShortUrl(ctx context.Context, shortUrl string) error {
+	co.forgetHotKey(shortUrl)
+	co.localCache.Delete(shortUrl)
+
+	if err := co.Cache.Delete(ctx, shortUrl); err != nil {
+		return err
+	}
+	if co.rdb == nil {
+		return nil
+	}
+	return co.rdb.Publish(ctx, cacheInvalidationChannel, shortUrl).Err()
+}
+
+// ListenCacheInvalidations helps to drop the short urls invalidated by any replica
+// from the in-process cache. This is an entire blocking loop.
+//
+// caller must run it in separate go routine.
+func (co *Core) ListenCacheInvalidations() {
+	pubsub := co.rdb.Subscribe(context.Background(), cacheInvalidationChannel)
+	defer pubsub.Close()
+
+	// The go-redis pub/sub reconnects by itself on connection failures.
+	for msg := range pubsub.Channel() {
+		co.forgetHotKey(msg.Payload)
+		co.localCache.Delete(msg.Payload)
+	}
+}
+
+// cacheTTL returns min(CacheMaxTTL, time until expirationAt).
+func (co *Core) cacheTTL(expirationAt time.Time) time.Duration {
+	return min(co.CacheMaxTTL, time.Until(expirationAt))
+}
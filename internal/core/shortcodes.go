@@ -0,0 +1,26 @@
+package core
+
+// minShortCodeKeyLength is the shortest SHORTCODE_KEY accepted, 128 bits of hex.
+const minShortCodeKeyLength = 32
+
+// EncodeSequenceID helps to encode the id of the sequence into its short url.
+//
+// The id is permuted with the SHORTCODE_KEY first, so the consecutive ids get
+// random looking, collision free short urls which can not be enumerated.
+func (co *Core) EncodeSequenceID(id uint64) (string, error) {
+	permuted, err := co.idPermutation.Permute(id)
+	if err != nil {
+		return "", err
+	}
+	return co.ShortCodes.Encode(permuted), nil
+}
+
+// DecodeSequenceID helps to find back the id of the sequence of the short url.
+// Meant for debugging, the short urls are never resolved by their id.
+func (co *Core) DecodeSequenceID(shortUrl string) (uint64, error) {
+	permuted, err := co.ShortCodes.Decode(shortUrl)
+	if err != nil {
+		return 0, err
+	}
+	return co.idPermutation.Invert(permuted)
+}
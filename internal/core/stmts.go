@@ -5,12 +5,29 @@ import "database/sql"
 // UrlShorterServiceQueries helps to prepare SQL statements
 // to be executed and required by the backend service.
 type UrlShorterServiceQueries struct {
-	GetUserByEmail           *sql.Stmt `query:"GetUserByEmail"`
-	CreateNewUser            *sql.Stmt `query:"CreateNewUser"`
-	CreateShortUrlQuery      *sql.Stmt `query:"CreateShortUrlQuery"`
-	GetShortUrlQuery         *sql.Stmt `query:"GetShortUrlQuery"`
-	IncrUrlHitCountQuery     *sql.Stmt `query:"IncrUrlHitCountQuery"`
-	GetIncrementalIDQuery    *sql.Stmt `query:"GetIncrementalIDQuery"`
-	GetAllShortUrlAliasQuery *sql.Stmt `query:"GetAllShortUrlAliasQuery"`
-	MostActiveHitsQuery      *sql.Stmt `query:"MostActiveHitsQuery"`
+	GetUserByEmail               *sql.Stmt `query:"GetUserByEmail"`
+	CreateNewUser                *sql.Stmt `query:"CreateNewUser"`
+	CreateShortUrlQuery          *sql.Stmt `query:"CreateShortUrlQuery"`
+	GetShortUrlQuery             *sql.Stmt `query:"GetShortUrlQuery"`
+	GetShortUrlOwnerQuery        *sql.Stmt `query:"GetShortUrlOwnerQuery"`
+	GetUserShortUrlQuery         *sql.Stmt `query:"GetUserShortUrlQuery"`
+	IncrUrlHitCountQuery         *sql.Stmt `query:"IncrUrlHitCountQuery"`
+	IncrUrlBotHitCountQuery      *sql.Stmt `query:"IncrUrlBotHitCountQuery"`
+	GetIncrementalIDQuery        *sql.Stmt `query:"GetIncrementalIDQuery"`
+	GetIDBlockSizeQuery          *sql.Stmt `query:"GetIDBlockSizeQuery"`
+	GetShortUrlAliasesSinceQuery *sql.Stmt `query:"GetShortUrlAliasesSinceQuery"`
+	CountActiveShortUrlsQuery    *sql.Stmt `query:"CountActiveShortUrlsQuery"`
+	ExpiredShortUrlAliasesQuery  *sql.Stmt `query:"ExpiredShortUrlAliasesQuery"`
+	ReclaimExpiredShortUrlQuery  *sql.Stmt `query:"ReclaimExpiredShortUrlQuery"`
+	RecentlyActiveUrlsQuery      *sql.Stmt `query:"RecentlyActiveUrlsQuery"`
+	TopLinksQuery                *sql.Stmt `query:"TopLinksQuery"`
+	RollupDailyUrlHitsQuery      *sql.Stmt `query:"RollupDailyUrlHitsQuery"`
+	GetRollupWatermarkQuery      *sql.Stmt `query:"GetRollupWatermarkQuery"`
+	PurgeRawUrlHitsQuery         *sql.Stmt `query:"PurgeRawUrlHitsQuery"`
+	GetUrlDailyStatsQuery        *sql.Stmt `query:"GetUrlDailyStatsQuery"`
+	ClaimIdempotencyKeyQuery     *sql.Stmt `query:"ClaimIdempotencyKeyQuery"`
+	GetIdempotencyKeyQuery       *sql.Stmt `query:"GetIdempotencyKeyQuery"`
+	SaveIdempotentResponseQuery  *sql.Stmt `query:"SaveIdempotentResponseQuery"`
+	ReleaseIdempotencyKeyQuery   *sql.Stmt `query:"ReleaseIdempotencyKeyQuery"`
+	PurgeIdempotencyKeysQuery    *sql.Stmt `query:"PurgeIdempotencyKeysQuery"`
 }
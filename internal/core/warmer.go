@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/cache"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/leader"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/tracing"
+)
+
+// warmerLeaseKey redis key of the lease electing the replica warming the cache.
+const warmerLeaseKey = "lease:cache-warmer"
+
+// warmerOverlap is re-scanned on every pass, covering the hits committed late
+// or stamped by a database clock running behind the replica.
+const warmerOverlap = 10 * time.Second
+
+// initWarmerLease helps to elect the replica warming the shared cache.
+// Every replica is its own leader when the cache is not backed by redis.
+func (co *Core) initWarmerLease() leader.Lease {
+	if co.rdb == nil {
+		return leader.LocalLease{}
+	}
+	// The leader renews the lease on every pass. Missing a few passes hands it over.
+	return leader.NewRedisLease(co.rdb, warmerLeaseKey, 3*co.WarmerInterval)
+}
+
+// CacheShortOriginalUrls helps to cache the short url and original url mappings into redis.
+// This is done to improve the performance of the GetOriginalUrlHandler.
+//
+// Only the replica holding the warmer lease warms the cache, every WarmerInterval.
+// A pass only caches the short urls clicked since the previous pass, the first
+// pass of a new leader looks back WarmerLookback. Failed passes are retried with
+// an exponential backoff instead of stopping the loop.
+//
+// caller must run it in separate go routine. As the alias will be huge distributed.
+func (co *Core) CacheShortOriginalUrls() {
+	backoff := breaker.Backoff{Min: 1 * time.Second, Max: co.WarmerInterval}
+
+	// Hits older than the watermark have already been warmed.
+	var warmedTill time.Time
+
+	for {
+		leading, err := co.warmerLease.Acquire(context.Background())
+		if err != nil {
+			co.Lo.Error("unable to acquire the cache warmer lease", "error", err)
+		}
+		if !leading {
+			// Another replica is warming. Start over from the lookback once elected.
+			warmedTill = time.Time{}
+			time.Sleep(co.WarmerInterval)
+			continue
+		}
+
+		since := time.Now().Add(-co.WarmerLookback)
+		if warmedTill.After(since) {
+			since = warmedTill.Add(-warmerOverlap)
+		}
+
+		passStartedAt := time.Now()
+		warmed, err := co.warmRecentlyActiveUrls(since)
+		metrics.BackgroundJobRuns.WithLabelValues("cache_warmer", metrics.Outcome(err)).Inc()
+		if err != nil {
+			delay := backoff.Next()
+			co.Lo.Error("unable to warm the cache", "error", err, "retryIn", delay)
+			time.Sleep(delay)
+			continue
+		}
+
+		co.Lo.Info("cache has been warmed", "since", since, "urls", warmed)
+		warmedTill = passStartedAt
+		backoff.Reset()
+		time.Sleep(co.WarmerInterval)
+	}
+}
+
+// warmRecentlyActiveUrls runs a single pass of the cache warming, caching the
+// short urls clicked by humans since the given time, most clicked first.
+// The entries are written in batches of WarmerBatchSize.
+func (co *Core) warmRecentlyActiveUrls(since time.Time) (int, error) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "CacheShortOriginalUrls")
+	defer span.End()
+
+	rows, err := co.QueryStmts.RecentlyActiveUrlsQuery.QueryContext(ctx, since, max(co.WarmerLimit, 1))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	warmed := 0
+	batch := make([]cache.Entry, 0, co.WarmerBatchSize)
+	for rows.Next() {
+		var originalUrl string
+		var shortUrl string
+		var expirationAt time.Time
+
+		err = rows.Scan(&originalUrl, &shortUrl, &expirationAt)
+		if err != nil {
+			return warmed, err
+		}
+
+		// Evicted at the latest when the short url expires.
+		ttl := co.cacheTTL(expirationAt)
+		if ttl <= 0 {
+			continue
+		}
+		batch = append(batch, cache.Entry{Key: shortUrl, Value: originalUrl, TTL: ttl})
+
+		if len(batch) == co.WarmerBatchSize {
+			if err = co.Cache.SetMany(ctx, batch); err != nil {
+				return warmed, err
+			}
+			warmed += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return warmed, err
+	}
+
+	if len(batch) > 0 {
+		if err = co.Cache.SetMany(ctx, batch); err != nil {
+			return warmed, err
+		}
+		warmed += len(batch)
+	}
+	return warmed, nil
+}
@@ -0,0 +1,263 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
+)
+
+// Broker fans out the click events of the redirect path to the live subscribers.
+type Broker interface {
+	// Publish the click event. Must never block the redirect path.
+	Publish(event models.ClickEvent)
+	// Subscribe to the click events of a short url.
+	// Caller must call the returned cancel func once done listening.
+	Subscribe(shortUrl string) (<-chan models.ClickEvent, func())
+}
+
+// subscriberBufferSize is the number of events buffered per subscriber.
+// Events are dropped for the slow subscribers once the buffer is full.
+const subscriberBufferSize = 64
+
+// MemoryBroker is an in-process Broker. Only the subscribers of the same
+// replica receive the events published.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan models.ClickEvent]struct{}
+}
+
+// NewMemoryBroker helps to create a new in-process broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[string]map[chan models.ClickEvent]struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(event models.ClickEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[event.ShortURL] {
+		// Non blocking send, drop the event for the slow subscriber.
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *MemoryBroker) Subscribe(shortUrl string) (<-chan models.ClickEvent, func()) {
+	ch := make(chan models.ClickEvent, subscriberBufferSize)
+
+	b.mu.Lock()
+	if _, found := b.subscribers[shortUrl]; !found {
+		b.subscribers[shortUrl] = make(map[chan models.ClickEvent]struct{})
+	}
+	b.subscribers[shortUrl][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers[shortUrl], ch)
+			if len(b.subscribers[shortUrl]) == 0 {
+				delete(b.subscribers, shortUrl)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, cancel
+}
+
+// shortUrls returns the short urls which have subscribers.
+func (b *MemoryBroker) shortUrls() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	shortUrls := make([]string, 0, len(b.subscribers))
+	for shortUrl := range b.subscribers {
+		shortUrls = append(shortUrls, shortUrl)
+	}
+	return shortUrls
+}
+
+// clickChannelPrefix redis pub/sub channel prefix of the click events.
+const clickChannelPrefix = "clicks:"
+
+// publishBufferSize is the number of events buffered for the redis publisher.
+// Events are dropped once the buffer is full, while redis is slow or down.
+const publishBufferSize = 1024
+
+// watchChannel redis pub/sub channel on which the replicas announce the short
+// urls their subscribers listen to. It does not match the click channels.
+const watchChannel = "clicks-watch"
+
+const (
+	// watchTTL is how long a short url stays watched after its last announce.
+	watchTTL = 30 * time.Second
+	// watchRefreshInterval is how often the replicas announce the short urls they listen to.
+	watchRefreshInterval = 10 * time.Second
+)
+
+// RedisBroker is a Broker backed by redis pub/sub, so the subscribers of every
+// replica receive the clicks served by any replica.
+//
+// Events are queued to a single publisher per replica, which publishes them
+// into redis, and a single pattern subscription per replica feeds them into
+// the local subscribers.
+//
+// Only the clicks of the watched short urls are published, the ones some
+// replica has subscribers for. Every replica announces the short urls it
+// listens to on the watch channel, so the redirects of the other short urls
+// never reach redis.
+type RedisBroker struct {
+	rdb       redis.UniversalClient
+	local     *MemoryBroker
+	publishes chan models.ClickEvent
+	lo        *slog.Logger
+
+	watchedMu sync.RWMutex
+	watched   map[string]time.Time // short url -> watched until
+}
+
+// NewRedisBroker helps to create a new redis pub/sub backed broker.
+// It starts publishing the events and listening to the click channels in separate go routines.
+func NewRedisBroker(rdb redis.UniversalClient, lo *slog.Logger) *RedisBroker {
+	b := &RedisBroker{
+		rdb:       rdb,
+		local:     NewMemoryBroker(),
+		publishes: make(chan models.ClickEvent, publishBufferSize),
+		lo:        lo,
+		watched:   make(map[string]time.Time),
+	}
+	go b.publish()
+	go b.listen()
+	go b.refreshWatches()
+	return b
+}
+
+func (b *RedisBroker) Publish(event models.ClickEvent) {
+	// Nobody listens to the clicks of the short url.
+	if !b.isWatched(event.ShortURL) {
+		return
+	}
+
+	// Non blocking send, drop the event when the publisher lags behind.
+	select {
+	case b.publishes <- event:
+	default:
+	}
+}
+
+// publish publishes the queued click events into redis, one at a time.
+func (b *RedisBroker) publish() {
+	for event := range b.publishes {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			b.lo.Error("unable to marshal click event", "error", err)
+			continue
+		}
+
+		err = b.rdb.Publish(context.Background(), clickChannelPrefix+event.ShortURL, payload).Err()
+		if err != nil {
+			b.lo.Error("unable to publish click event", "shortUrl", event.ShortURL, "error", err)
+		}
+	}
+}
+
+func (b *RedisBroker) Subscribe(shortUrl string) (<-chan models.ClickEvent, func()) {
+	ch, cancel := b.local.Subscribe(shortUrl)
+
+	// Start publishing on this replica right away, and on the others once announced.
+	b.watch(shortUrl)
+	go b.announce(shortUrl)
+
+	return ch, cancel
+}
+
+// isWatched checks whether some replica has subscribers for the short url.
+func (b *RedisBroker) isWatched(shortUrl string) bool {
+	b.watchedMu.RLock()
+	defer b.watchedMu.RUnlock()
+
+	until, found := b.watched[shortUrl]
+	return found && time.Now().Before(until)
+}
+
+// watch marks the short url as watched for the watchTTL.
+func (b *RedisBroker) watch(shortUrl string) {
+	b.watchedMu.Lock()
+	defer b.watchedMu.Unlock()
+
+	b.watched[shortUrl] = time.Now().Add(watchTTL)
+}
+
+// announce tells every replica the short url has subscribers.
+func (b *RedisBroker) announce(shortUrl string) {
+	ctx, cancel := context.WithTimeout(context.Background(), watchRefreshInterval)
+	defer cancel()
+
+	if err := b.rdb.Publish(ctx, watchChannel, shortUrl).Err(); err != nil {
+		b.lo.Error("unable to announce the watched short url", "shortUrl", shortUrl, "error", err)
+	}
+}
+
+// refreshWatches announces the short urls of the local subscribers periodically,
+// and forgets the short urls nobody announced for the watchTTL.
+// So a replica started later learns the watched short urls within the interval.
+func (b *RedisBroker) refreshWatches() {
+	ticker := time.NewTicker(watchRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, shortUrl := range b.local.shortUrls() {
+			b.announce(shortUrl)
+		}
+
+		now := time.Now()
+		b.watchedMu.Lock()
+		for shortUrl, until := range b.watched {
+			if now.After(until) {
+				delete(b.watched, shortUrl)
+			}
+		}
+		b.watchedMu.Unlock()
+	}
+}
+
+// listen relays the click events received from redis to the local subscribers,
+// and records the watched short urls announced by the replicas.
+// The go-redis pub/sub reconnects by itself on connection failures.
+func (b *RedisBroker) listen() {
+	pubsub := b.rdb.PSubscribe(context.Background(), clickChannelPrefix+"*")
+	defer pubsub.Close()
+
+	if err := pubsub.Subscribe(context.Background(), watchChannel); err != nil {
+		b.lo.Error("unable to subscribe to the watched short urls", "error", err)
+	}
+
+	for msg := range pubsub.Channel() {
+		if msg.Channel == watchChannel {
+			b.watch(msg.Payload)
+			continue
+		}
+
+		var event models.ClickEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			b.lo.Error("unable to unmarshal click event", "channel", msg.Channel, "error", err)
+			continue
+		}
+		event.ShortURL = strings.TrimPrefix(msg.Channel, clickChannelPrefix)
+		b.local.Publish(event)
+	}
+}
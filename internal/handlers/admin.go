@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
+)
+
+// HotKeysHandler (admin) returns the short urls currently detected hot, hottest first.
+func HotKeysHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the core from context.
+	co := r.Context().Value("co").(*core.Core)
+
+	hotKeys := co.GetHotKeys()
+	WriteJson(w, http.StatusOK, map[string]any{
+		"threshold": co.HotKeyThreshold,
+		"count":     len(hotKeys),
+		"hot_keys":  hotKeys,
+	})
+}
+
+// BloomFilterInfoHandler (admin) returns the configuration and the saturation of the bloom filter.
+func BloomFilterInfoHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the core from context.
+	co := r.Context().Value("co").(*core.Core)
+
+	WriteJson(w, http.StatusOK, map[string]any{
+		"loaded": co.BloomFilterLoaded(),
+		"info":   co.BloomFilter.Info(),
+	})
+}
+
+// BloomFilterRebuildHandler (admin) requests a rebuild of the bloom filter from the database.
+// The rebuild runs in the background, the current filter keeps serving meanwhile.
+func BloomFilterRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the core from context.
+	co := r.Context().Value("co").(*core.Core)
+
+	if !co.RequestBloomRebuild() {
+		WriteError(w, http.StatusConflict, errors.New("a bloom filter rebuild is already pending"))
+		return
+	}
+	co.Lo.Info("bloom filter rebuild requested", "by", r.Context().Value("userEmail"))
+	WriteJson(w, http.StatusAccepted, "bloom filter rebuild has been requested.")
+}
+
+// DecodeShortCodeHandler (admin) returns the id of the sequence a generated (v2) short url was encoded from.
+// Meant for debugging only.
+func DecodeShortCodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the core from context.
+	co := r.Context().Value("co").(*core.Core)
+
+	code := r.PathValue("code")
+	id, err := co.DecodeSequenceID(code)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	WriteJson(w, http.StatusOK, map[string]any{
+		"code": code,
+		"id":   id,
+	})
+}
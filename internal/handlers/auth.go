@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -80,7 +81,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Create JWT token for the user.
-	token, err := createJwtToken(co, user.Email, user.Password)
+	token, err := createJwtToken(r.Context(), co, user.Email, user.Password)
 	if err != nil {
 		WriteError(w, http.StatusUnauthorized, errors.New("username or password are incorrect"))
 		return
@@ -169,14 +170,14 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Register the user.
-	_, err = co.QueryStmts.CreateNewUser.Exec(user.Name, user.Email, hashed)
+	_, err = co.QueryStmts.CreateNewUser.ExecContext(r.Context(), user.Name, user.Email, hashed)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, errors.New("user already exists. or request is malformed"))
 		return
 	}
 
 	// Create JWT token for the user.
-	token, err := createJwtToken(co, user.Email, user.Password)
+	token, err := createJwtToken(r.Context(), co, user.Email, user.Password)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err)
 		return
@@ -190,10 +191,10 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 // createJwtToken helps to generate an access token for the user.
 //
 // JWT Token which validates the user credentials.
-func createJwtToken(co *core.Core, email, password string) (string, error) {
+func createJwtToken(ctx context.Context, co *core.Core, email, password string) (string, error) {
 	var userInDB UserLoginDto
 	// Check the user present in DB
-	co.QueryStmts.GetUserByEmail.QueryRow(email).Scan(&userInDB.ID, &userInDB.Email, &userInDB.Password)
+	co.QueryStmts.GetUserByEmail.QueryRowContext(ctx, email).Scan(&userInDB.ID, &userInDB.Email, &userInDB.Password)
 	co.Lo.Info("checking user exists", "email", email)
 	// If no user found.
 	if userInDB.ID == 0 || userInDB.Email == "" {
@@ -5,7 +5,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/sounishnath003/url-shortner-service-golang/internal/breaker"
 	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/traffic"
 )
 
 // GetShortenUrlHandler gets the shorten url from the url provided in the path param.
@@ -16,51 +20,100 @@ func GetShortenUrlHandler(w http.ResponseWriter, r *http.Request) {
 	// Grab core from context.
 	co := r.Context().Value("co").(*core.Core)
 
-	_, err := co.QueryStmts.IncrUrlHitCountQuery.Exec(shortUrl)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, errors.New("No url found for the given shorten url"))
+	// Observe the redirect latency by the tier which resolved the short url.
+	start := time.Now()
+	outcome := "not_found"
+	defer func() {
+		metrics.RedirectDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	}()
+
+	originalUrl, source, err := co.ResolveShortUrl(r.Context(), shortUrl)
+	if errors.Is(err, core.ErrShortUrlNotFound) {
+		WriteError(w, http.StatusNotFound, err)
 		return
 	}
-
-	// Check the URL is present in cache.
-	originalUrl, err := co.FindOriginalUrlFromCache(shortUrl)
-	if err == nil && len(originalUrl) > 0 {
-		co.Lo.Info("[CACHE_HIT]", "originalUrl", originalUrl, "shortUrl", shortUrl)
-		http.Redirect(w, r, originalUrl, http.StatusFound)
+	if errors.Is(err, core.ErrUnavailable) {
+		outcome = "unavailable"
+		w.Header().Set("Retry-After", "10")
+		WriteError(w, http.StatusServiceUnavailable, err)
 		return
 	}
-	co.Lo.Info("[CACHE_MISS]", "originalUrl", originalUrl, "shortUrl", shortUrl)
-
-	// Get the original url from the database.
-	var expirationAt time.Time
-
-	err = co.QueryStmts.GetShortUrlQuery.QueryRow(shortUrl).Scan(&originalUrl, &expirationAt)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, errors.New("No url found for the given shorten url"))
+		co.Lo.Error("unable to resolve the short url", "shortUrl", shortUrl, "error", err)
+		WriteError(w, http.StatusInternalServerError, errors.New("unable to resolve the short url"))
 		return
 	}
+	outcome = source
 
-	if len(originalUrl) == 0 {
-		WriteError(w, http.StatusBadGateway, errors.New("short url has been expired. or url found."))
+	// Classify the visitor. Bots still get redirected, but their hits are
+	// tracked separately and never counted as human clicks.
+	visit := traffic.Classify(r)
+	click := newClickEvent(r, shortUrl, visit)
+	if visit.IsBot {
+		co.Lo.Info("[BOT_TRAFFIC]", "shortUrl", shortUrl, "reason", visit.Reason)
+	}
+
+	// Only the resolved short urls are counted. A failure here must not fail the redirect.
+	err = co.CountHit(r.Context(), click)
+	if err != nil && !errors.Is(err, breaker.ErrOpen) {
+		co.Lo.Error("unable to count the hit", "shortUrl", shortUrl, "error", err)
 	}
 
 	// Redirect to the original url.
+	co.Clicks.Publish(click)
 	http.Redirect(w, r, originalUrl, http.StatusFound)
 }
 
+// newClickEvent helps to build the click event of the redirect.
+func newClickEvent(r *http.Request, shortUrl string, visit traffic.Classification) models.ClickEvent {
+	referrer := r.Referer()
+	// Fit the referrer into the raw hits column.
+	if len(referrer) > 255 {
+		referrer = referrer[:255]
+	}
+
+	return models.ClickEvent{
+		ShortURL: shortUrl,
+		Time:     time.Now(),
+		Country:  traffic.Country(r),
+		Referrer: referrer,
+		Device:   traffic.Device(r, visit),
+		IsBot:    visit.IsBot,
+	}
+}
+
 func CustomAliasAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 	// Grab the alias.
 	customAlias := r.URL.Path[len("/api/check-alias/"):]
 
 	// Get the core.Core context
 	co := r.Context().Value("co").(*core.Core)
-	// Check the existence.
-	co.Lo.Info("checking customAlias available using bloom filter", "alias", customAlias)
-	_, exists := co.BloomFilter.Exists(customAlias)
-	if exists {
-		WriteJson(w, http.StatusNotAcceptable, "alias is already taken. Try another one.")
+	// Check the existence. The bloom filter positives are confirmed against the database.
+	co.Lo.Info("checking customAlias availability", "alias", customAlias)
+	availability, err := co.CheckAliasAvailability(r.Context(), customAlias)
+	if errors.Is(err, core.ErrUnavailable) {
+		w.Header().Set("Retry-After", "10")
+		WriteError(w, http.StatusServiceUnavailable, err)
 		return
 	}
+	if err != nil {
+		co.Lo.Error("unable to check the alias availability", "alias", customAlias, "error", err)
+		WriteError(w, http.StatusInternalServerError, errors.New("unable to check the alias availability"))
+		return
+	}
+
+	WriteJson(w, AliasAvailabilityStatus(availability), availability)
+}
 
-	WriteJson(w, http.StatusOK, "alias is available.")
+// AliasAvailabilityStatus returns the http status of the alias availability.
+// 200 when available, 400 when invalid and 406 when taken or reserved.
+func AliasAvailabilityStatus(availability models.AliasAvailability) int {
+	switch {
+	case availability.Available:
+		return http.StatusOK
+	case availability.Reason == core.AliasInvalid:
+		return http.StatusBadRequest
+	default:
+		return http.StatusNotAcceptable
+	}
 }
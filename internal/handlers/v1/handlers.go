@@ -2,6 +2,7 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
 	"github.com/sounishnath003/url-shortner-service-golang/internal/handlers"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/models"
 )
 
 // HealthHandler works as a health check endpoint for the api.
@@ -51,34 +53,64 @@ func GenerateUrlShortenerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	encodedUrl, err := GetMd5Hash(&url)
-	if err != nil {
-		handlers.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
+	// Grab core from context.
+	co := r.Context().Value("co").(*core.Core)
+	// Get the user from context
+	userID := r.Context().Value("userID").(int)
 
-	// Convert these bytes to decimal: 1b3aabf5266b (hexadecimal) → 47770830013755 (decimal).
-	num, err := strconv.ParseInt(encodedUrl, 16, 64)
-	if err != nil {
-		handlers.WriteError(w, http.StatusInternalServerError, err)
+	// The same url shortened again by the user gets its existing short url back.
+	existing, err := co.FindUserShortUrl(r.Context(), url.OriginalUrl, userID)
+	if err == nil {
+		writeExistingShortUrl(w, r, existing)
 		return
 	}
-
-	shortUrl, err := EncodeToBase62(num)
-	if err != nil {
-		handlers.WriteError(w, http.StatusInternalServerError, err)
+	if !handleLookupError(w, err) {
 		return
 	}
 
-	// Grab core from context.
-	co := r.Context().Value("co").(*core.Core)
-	// Get the user from context
-	userID := r.Context().Value("userID").(int)
+	var shortUrl string
+	for attempt := range MAX_HASH_ATTEMPTS {
+		encodedUrl, err := GetMd5Hash(&url, attempt)
+		if err != nil {
+			handlers.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
 
-	// Save it to database.
-	err = co.CreateNewShortUrlAsTxn(url.OriginalUrl, shortUrl, url.ExpiryDate, userID)
-	if err != nil {
-		handlers.WriteError(w, http.StatusInternalServerError, err)
+		// Convert these bytes to decimal: 1b3aabf5266b (hexadecimal) → 47770830013755 (decimal).
+		num, err := strconv.ParseInt(encodedUrl, 16, 64)
+		if err != nil {
+			handlers.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Encode the number into the short url: 47770830013755 → dz1ZYpEn.
+		shortUrl = co.ShortCodes.Encode(uint64(num))
+
+		// Save it to database.
+		err = co.CreateNewShortUrlAsTxn(r.Context(), url.OriginalUrl, shortUrl, url.ExpiryDate, userID)
+		if !errors.Is(err, core.ErrShortUrlTaken) {
+			if err != nil {
+				handlers.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+			break
+		}
+
+		// The hash collides with another short url. It might be the one of a
+		// concurrent request of the user for the same url.
+		existing, err := co.FindUserShortUrl(r.Context(), url.OriginalUrl, userID)
+		if err == nil {
+			writeExistingShortUrl(w, r, existing)
+			return
+		}
+		if !handleLookupError(w, err) {
+			return
+		}
+		co.Lo.Info("[HASH_COLLISION]", "shortUrl", shortUrl, "attempt", attempt)
+		shortUrl = ""
+	}
+	if len(shortUrl) == 0 {
+		handlers.WriteError(w, http.StatusConflict, errors.New("unable to generate a unique short url. Try again."))
 		return
 	}
 
@@ -88,3 +120,27 @@ func GenerateUrlShortenerHandler(w http.ResponseWriter, r *http.Request) {
 		"expiryBy": url.ExpiryDate,
 	})
 }
+
+// writeExistingShortUrl helps to respond with the short url the user already created for the url.
+func writeExistingShortUrl(w http.ResponseWriter, r *http.Request, existing models.Url) {
+	handlers.WriteJson(w, http.StatusOK, map[string]any{
+		"shortUrl": fmt.Sprintf("%s/%s", r.Host, existing.ShortURL),
+		"message":  "short url already exists",
+		"expiryBy": existing.ExpirationAt,
+	})
+}
+
+// handleLookupError helps to respond to the errors of the short url lookups.
+// Returns true when the short url was not found, and the request can go on.
+func handleLookupError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, core.ErrShortUrlNotFound):
+		return true
+	case errors.Is(err, core.ErrUnavailable):
+		w.Header().Set("Retry-After", "10")
+		handlers.WriteError(w, http.StatusServiceUnavailable, err)
+	default:
+		handlers.WriteError(w, http.StatusInternalServerError, err)
+	}
+	return false
+}
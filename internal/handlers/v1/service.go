@@ -5,13 +5,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"strconv"
 	"time"
 )
 
-var (
-	BASE_CHARACTERS = "abcdefghijklmnopqrsuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	BASE_LEN        = len(BASE_CHARACTERS)
-)
+// MAX_HASH_ATTEMPTS number of salted hashes tried before giving up on the collisions.
+const MAX_HASH_ATTEMPTS = 5
 
 // SanitizeURLChecks helps to sanitize the url before the creation
 // shorten urls.
@@ -44,25 +43,13 @@ func SanitizeURLChecks(urlInfo *CreateUShortenUrlDto) error {
 }
 
 // GetMd5Hash helps to generate the 6 bytes hash encoded infromation.
-func GetMd5Hash(urlInfo *CreateUShortenUrlDto) (string, error) {
+// The url is salted with the attempt on the retries, so a collision gets another hash.
+func GetMd5Hash(urlInfo *CreateUShortenUrlDto, attempt int) (string, error) {
 	hasher := md5.New()
 	hasher.Write([]byte(urlInfo.OriginalUrl))
+	if attempt > 0 {
+		hasher.Write([]byte("#" + strconv.Itoa(attempt)))
+	}
 	shortenUrl := hex.EncodeToString(hasher.Sum(nil))[:6]
 	return shortenUrl, nil
 }
-
-// EncodeToBase62 helps to generate the base62 encoded string from the number int64.
-//
-// Encode the result into a Base62 encoded string: DZFbb43.
-func EncodeToBase62(num int64) (string, error) {
-	shortUrl := make([]byte, 1)
-	k := 0
-	for num > 0 {
-		rem := num % int64(BASE_LEN)
-		shortUrl = append(shortUrl, []byte(BASE_CHARACTERS)[rem])
-		num = num / 10
-		k += 1
-	}
-
-	return string(shortUrl[1:]), nil
-}
@@ -7,3 +7,10 @@ type CreateUShortenUrlDto struct {
 	CustomAlias string    `json:"custom_alias"`
 	ExpiryDate  time.Time `json:"expiry_date"`
 }
+
+type TopLinksQueryDto struct {
+	WindowName string
+	Window     time.Duration
+	Scope      string
+	Limit      int
+}
@@ -1,11 +1,13 @@
 package v2
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
@@ -58,24 +60,22 @@ func GenerateUrlShortenerHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if custom alias provided in body.
 	shortUrl := url.CustomAlias
+	generated := len(shortUrl) == 0
 
-	// If no shortUrl is defined then generate a unique short url
-	if len(shortUrl) == 0 {
-		var num int
-		// Get the incremental ID (distributed-ACID-compliant) safe
-		// Comes at cost of performance in read heavy environment.
-		co.QueryStmts.GetIncrementalIDQuery.QueryRow().Scan(&num)
-
-		shortUrl, err = EncodeToBase62(int64(num))
+	if !generated {
+		// Double check the alias, suggesting the available ones when not.
+		availability, err := co.CheckAliasAvailability(r.Context(), shortUrl)
+		if errors.Is(err, core.ErrUnavailable) {
+			w.Header().Set("Retry-After", "10")
+			handlers.WriteError(w, http.StatusServiceUnavailable, err)
+			return
+		}
 		if err != nil {
 			handlers.WriteError(w, http.StatusInternalServerError, err)
 			return
 		}
-	} else {
-		// Double check the alias
-		_, exists := co.BloomFilter.Exists(shortUrl)
-		if exists {
-			handlers.WriteError(w, http.StatusNotAcceptable, errors.New("alias is already taken. Try another one."))
+		if !availability.Available {
+			handlers.WriteJson(w, handlers.AliasAvailabilityStatus(availability), availability)
 			return
 		}
 	}
@@ -83,8 +83,38 @@ func GenerateUrlShortenerHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the user from context
 	userID := r.Context().Value("userID").(int)
 
-	// Save it to database.
-	err = co.CreateNewShortUrlAsTxn(url.OriginalUrl, shortUrl, url.ExpiryDate, userID)
+	for attempt := range MAX_ID_ATTEMPTS {
+		// If no shortUrl is defined then generate a unique short url
+		if generated {
+			shortUrl, err = NextShortUrl(r.Context(), co)
+			if errors.Is(err, core.ErrUnavailable) {
+				w.Header().Set("Retry-After", "10")
+				handlers.WriteError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			if err != nil {
+				handlers.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		// Save it to database.
+		err = co.CreateNewShortUrlAsTxn(r.Context(), url.OriginalUrl, shortUrl, url.ExpiryDate, userID)
+		// A generated short url can only be taken by a custom alias, try the next id.
+		if generated && errors.Is(err, core.ErrShortUrlTaken) && attempt < MAX_ID_ATTEMPTS-1 {
+			continue
+		}
+		break
+	}
+	if errors.Is(err, core.ErrShortUrlTaken) {
+		if generated {
+			handlers.WriteError(w, http.StatusInternalServerError, errors.New("unable to generate an available short url"))
+			return
+		}
+		// Taken by a concurrent request, right after the availability check.
+		handlers.WriteError(w, http.StatusConflict, errors.New("alias is already taken. Try another one."))
+		return
+	}
 	if err != nil {
 		handlers.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -96,3 +126,170 @@ func GenerateUrlShortenerHandler(w http.ResponseWriter, r *http.Request) {
 		"expiryBy": url.ExpiryDate,
 	})
 }
+
+// TopLinksHandler (v2) returns the leaderboard of the trending links.
+//
+// Query params:
+// - window: 1h | 24h | 7d (default 24h)
+// - scope: me | workspace | global (default me, global is admin only)
+// - limit: number of links to return (default 10, max 100)
+func TopLinksHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the from context.
+	co := r.Context().Value("co").(*core.Core)
+	userID := r.Context().Value("userID").(int)
+	userEmail := r.Context().Value("userEmail").(string)
+
+	query, err := ParseTopLinksQuery(r.URL.Query())
+	if err != nil {
+		handlers.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if query.Scope == core.ScopeGlobal && !co.IsAdmin(userEmail) {
+		handlers.WriteError(w, http.StatusForbidden, errors.New("global scope is only available to admins"))
+		return
+	}
+
+	// Only the users of the configured workspace domains have a workspace.
+	var workspaceDomain string
+	if query.Scope == core.ScopeWorkspace {
+		domain, ok := co.WorkspaceDomain(userEmail)
+		if !ok {
+			handlers.WriteError(w, http.StatusForbidden, errors.New("workspace scope is only available to the users of a workspace domain"))
+			return
+		}
+		workspaceDomain = domain
+	}
+
+	links, err := co.GetTopLinks(r.Context(), query.Window, query.Scope, userID, workspaceDomain, query.Limit)
+	if err != nil {
+		handlers.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	handlers.WriteJson(w, http.StatusOK, map[string]any{
+		"window": query.WindowName,
+		"scope":  query.Scope,
+		"links":  links,
+	})
+}
+
+// LiveClicksHandler (v2) streams the click events of the short url as Server-Sent Events.
+// Only the owner of the short url is allowed to listen to its clicks.
+//
+// Every click is sent as a `click` event with the json encoded models.ClickEvent,
+// and a comment heartbeat is sent periodically to keep the connection alive.
+func LiveClicksHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the from context.
+	co := r.Context().Value("co").(*core.Core)
+	userID := r.Context().Value("userID").(int)
+	shortUrl := r.PathValue("alias")
+
+	if !authorizeShortUrlOwner(w, r, co, shortUrl, userID) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handlers.WriteError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	clicks, cancel := co.Clicks.Subscribe(shortUrl)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	co.Lo.Info("live click stream opened", "shortUrl", shortUrl, "userID", userID)
+	defer co.Lo.Info("live click stream closed", "shortUrl", shortUrl, "userID", userID)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event := <-clicks:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: click\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// UrlStatsHandler (v2) returns the daily hits of the short url owned by the user.
+//
+// Query params:
+// - days: number of days to look back, including today (default 30, max 365)
+func UrlStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Grab the from context.
+	co := r.Context().Value("co").(*core.Core)
+	userID := r.Context().Value("userID").(int)
+	shortUrl := r.PathValue("alias")
+
+	days := 30
+	if param := r.URL.Query().Get("days"); len(param) > 0 {
+		num, err := strconv.Atoi(param)
+		if err != nil || num < 1 || num > 365 {
+			handlers.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid days: %s. allowed 1 to 365", param))
+			return
+		}
+		days = num
+	}
+
+	if !authorizeShortUrlOwner(w, r, co, shortUrl, userID) {
+		return
+	}
+
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	stats, err := co.GetUrlDailyStats(r.Context(), shortUrl, since)
+	if err != nil {
+		handlers.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	totalHits, totalBotHits := 0, 0
+	for _, stat := range stats {
+		totalHits += stat.Hits
+		totalBotHits += stat.BotHits
+	}
+
+	handlers.WriteJson(w, http.StatusOK, map[string]any{
+		"shortUrl":     shortUrl,
+		"since":        since,
+		"totalHits":    totalHits,
+		"totalBotHits": totalBotHits,
+		"days":         stats,
+	})
+}
+
+// authorizeShortUrlOwner helps to check the user owns the short url.
+// Writes the error response and returns false when the short url
+// does not exist or the user is not its owner.
+func authorizeShortUrlOwner(w http.ResponseWriter, r *http.Request, co *core.Core, shortUrl string, userID int) bool {
+	ownerID, err := co.GetShortUrlOwner(r.Context(), shortUrl)
+	if errors.Is(err, sql.ErrNoRows) {
+		handlers.WriteError(w, http.StatusNotFound, errors.New("No url found for the given shorten url"))
+		return false
+	}
+	if err != nil {
+		handlers.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if ownerID != userID {
+		handlers.WriteError(w, http.StatusForbidden, errors.New("you are not the owner of the short url"))
+		return false
+	}
+	return true
+}
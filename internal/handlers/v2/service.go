@@ -1,18 +1,30 @@
 package v2
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/sounishnath003/url-shortner-service-golang/internal/core"
 )
 
 var (
-	BASE_CHARACTERS = "abcdefghijklmnopqrsuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	BASE_LEN        = len(BASE_CHARACTERS)
+	// TOP_LINKS_WINDOWS supported windows of the top links leaderboard.
+	TOP_LINKS_WINDOWS = map[string]time.Duration{
+		"1h":  1 * time.Hour,
+		"24h": 24 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+	}
 )
 
+// MAX_ID_ATTEMPTS number of generated short urls tried before giving up on the
+// collisions with the custom aliases.
+const MAX_ID_ATTEMPTS = 5
+
 // SanitizeURLChecks helps to sanitize the url before the creation
 // shorten urls.
 // This will also fill the default expiry to parameter if the expiry date is not provided.
@@ -42,6 +54,19 @@ func SanitizeURLChecks(urlInfo *CreateUShortenUrlDto) error {
 	return nil
 }
 
+// NextShortUrl helps to generate the short url of the next id.
+//
+// Get the incremental ID (distributed-ACID-compliant) safe, out of the block of
+// ids leased by the replica. Only the first shorten of a block reaches the sequence.
+// The id is permuted, so the consecutive short urls can not be enumerated.
+func NextShortUrl(ctx context.Context, co *core.Core) (string, error) {
+	num, err := co.IDs.NextID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return co.EncodeSequenceID(num)
+}
+
 // GetMd5Hash helps to generate the 6 bytes hash encoded infromation.
 func GetMd5Hash(urlInfo *CreateUShortenUrlDto) (string, error) {
 	hasher := md5.New()
@@ -50,18 +75,38 @@ func GetMd5Hash(urlInfo *CreateUShortenUrlDto) (string, error) {
 	return shortenUrl, nil
 }
 
-// EncodeToBase62 helps to generate the base62 encoded string from the number int64.
-//
-// Encode the result into a Base62 encoded string: DZFbb43.
-func EncodeToBase62(num int64) (string, error) {
-	shortUrl := make([]byte, 1)
-	k := 0
-	for num > 0 {
-		rem := num % int64(BASE_LEN)
-		shortUrl = append(shortUrl, []byte(BASE_CHARACTERS)[rem])
-		num = num / 10
-		k += 1
+// ParseTopLinksQuery helps to parse and validate the query params of the top links leaderboard.
+// Fills the defaults (24h window, me scope, 10 links) when not provided.
+func ParseTopLinksQuery(params url.Values) (TopLinksQueryDto, error) {
+	query := TopLinksQueryDto{
+		WindowName: params.Get("window"),
+		Scope:      params.Get("scope"),
+		Limit:      10,
+	}
+
+	if len(query.WindowName) == 0 {
+		query.WindowName = "24h"
+	}
+	window, found := TOP_LINKS_WINDOWS[query.WindowName]
+	if !found {
+		return query, fmt.Errorf("invalid window: %s. allowed 1h, 24h, 7d", query.WindowName)
+	}
+	query.Window = window
+
+	if len(query.Scope) == 0 {
+		query.Scope = core.ScopeMe
+	}
+	if query.Scope != core.ScopeMe && query.Scope != core.ScopeWorkspace && query.Scope != core.ScopeGlobal {
+		return query, fmt.Errorf("invalid scope: %s. allowed me, workspace, global", query.Scope)
+	}
+
+	if limit := params.Get("limit"); len(limit) > 0 {
+		num, err := strconv.Atoi(limit)
+		if err != nil || num < 1 || num > 100 {
+			return query, fmt.Errorf("invalid limit: %s. allowed 1 to 100", limit)
+		}
+		query.Limit = num
 	}
 
-	return string(shortUrl[1:]), nil
+	return query, nil
 }
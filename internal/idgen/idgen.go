@@ -0,0 +1,67 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Generators of the ids.
+const (
+	GeneratorSequence  = "sequence"
+	GeneratorSnowflake = "snowflake"
+)
+
+// Generator hands out unique ids, across every replica of the service.
+type Generator interface {
+	NextID(ctx context.Context) (uint64, error)
+}
+
+// BlockAllocator is a Generator handing out the ids of blocks leased from a
+// shared counter (a postgres sequence incremented by the block size), so only
+// one id in blockSize costs a round trip.
+//
+// The ids left in the block are never handed out again once the replica
+// restarts, the counter has moved past them. So the ids are unique, but not
+// gapless nor ordered across the replicas.
+type BlockAllocator struct {
+	leaseBlock func(ctx context.Context) (uint64, error)
+	blockSize  uint64
+
+	mu   sync.Mutex
+	next uint64
+	end  uint64 // the block is exhausted once next reaches end
+}
+
+// NewBlockAllocator helps to create an allocator of the blocks of blockSize ids.
+// leaseBlock must return the first id of a new block, never returned before.
+func NewBlockAllocator(blockSize uint64, leaseBlock func(ctx context.Context) (uint64, error)) (*BlockAllocator, error) {
+	if blockSize == 0 {
+		return nil, fmt.Errorf("block size must be positive: %d", blockSize)
+	}
+	return &BlockAllocator{leaseBlock: leaseBlock, blockSize: blockSize}, nil
+}
+
+// BlockSize returns the number of ids of a block.
+func (a *BlockAllocator) BlockSize() uint64 {
+	return a.blockSize
+}
+
+func (a *BlockAllocator) NextID(ctx context.Context) (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Lease the next block once exhausted. The concurrent callers wait for it,
+	// rather than leasing blocks of their own.
+	if a.next == a.end {
+		start, err := a.leaseBlock(ctx)
+		if err != nil {
+			return 0, err
+		}
+		a.next, a.end = start, start+a.blockSize
+	}
+
+	id := a.next
+	a.next++
+	return id, nil
+}
@@ -0,0 +1,88 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Layout of the snowflake ids: 41 bits of milliseconds since the epoch
+// (~69 years), 10 bits of node id and 12 bits of sequence per millisecond.
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+
+	// MaxSnowflakeNode is the highest node id of a snowflake generator.
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+	maxSequence      = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeEpoch is the epoch of the timestamps of the snowflake ids.
+var SnowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake is a Generator of time ordered 63 bits ids, without any
+// coordination nor round trip. Unique as long as every replica runs with its
+// own node id, and 4096 ids per millisecond and replica at most.
+type Snowflake struct {
+	node uint64
+
+	mu       sync.Mutex
+	lastMs   int64
+	sequence uint64
+}
+
+// NewSnowflake helps to create a snowflake generator for the node id (0 to MaxSnowflakeNode).
+func NewSnowflake(node int) (*Snowflake, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node id must be 0 to %d: %d", MaxSnowflakeNode, node)
+	}
+	return &Snowflake{node: uint64(node)}, nil
+}
+
+func (s *Snowflake) NextID(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Since(SnowflakeEpoch).Milliseconds()
+	for now < s.lastMs {
+		// The clock went backwards, wait for it to catch up rather than repeating the ids.
+		if err := sleep(ctx, time.Duration(s.lastMs-now)*time.Millisecond); err != nil {
+			return 0, err
+		}
+		now = time.Since(SnowflakeEpoch).Milliseconds()
+	}
+
+	if now == s.lastMs {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// The sequence is exhausted for this millisecond, wait for the next one.
+			for now <= s.lastMs {
+				if err := sleep(ctx, 100*time.Microsecond); err != nil {
+					return 0, err
+				}
+				now = time.Since(SnowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMs = now
+
+	return uint64(now)<<(snowflakeNodeBits+snowflakeSequenceBits) |
+		s.node<<snowflakeSequenceBits |
+		s.sequence, nil
+}
+
+// sleep waits for d, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Lease elects a single replica to run a background job.
+// The lease has to be renewed before it expires, otherwise another replica takes it over.
+type Lease interface {
+	// Acquire takes the lease, or renews it when already held by the replica.
+	// Returns whether the replica holds the lease.
+	Acquire(ctx context.Context) (bool, error)
+	// Release gives up the lease when held by the replica.
+	Release(ctx context.Context) error
+}
+
+// renewScript extends the lease only when it is still held by the replica.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript drops the lease only when it is still held by the replica.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisLease is a Lease shared by the replicas through a redis key.
+type RedisLease struct {
+	rdb redis.UniversalClient
+	key string
+	id  string
+	ttl time.Duration
+}
+
+// NewRedisLease helps to create a new lease on the redis key, expiring after ttl when not renewed.
+func NewRedisLease(rdb redis.UniversalClient, key string, ttl time.Duration) *RedisLease {
+	return &RedisLease{rdb: rdb, key: key, id: instanceID(), ttl: ttl}
+}
+
+func (l *RedisLease) Acquire(ctx context.Context) (bool, error) {
+	renewed, err := renewScript.Run(ctx, l.rdb, []string{l.key}, l.id, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+
+	return l.rdb.SetNX(ctx, l.key, l.id, l.ttl).Result()
+}
+
+func (l *RedisLease) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.rdb, []string{l.key}, l.id).Err()
+}
+
+// LocalLease is a Lease always held, for the deployments without redis
+// where every replica runs on its own.
+type LocalLease struct{}
+
+func (LocalLease) Acquire(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (LocalLease) Release(ctx context.Context) error {
+	return nil
+}
+
+// instanceID helps to identify the replica holding the lease.
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(suffix))
+}
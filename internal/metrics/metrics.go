@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exposed by the service.
+const namespace = "url_shortner"
+
+var (
+	// RedirectDuration observes the latency of the redirects,
+	// labelled by the tier which resolved the short url.
+	RedirectDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redirect_duration_seconds",
+		Help:      "Latency of the short url redirects.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"source"})
+
+	// CacheLookups counts the short url lookups in the cache tiers (local, redis),
+	// by result (hit, miss, error).
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Short url lookups in the cache tiers by result.",
+	}, []string{"tier", "result"})
+
+	// CoalescedLookups counts the short url lookups served by the concurrent lookup
+	// of the same short url, instead of querying redis and the database themselves.
+	CoalescedLookups = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coalesced_lookups_total",
+		Help:      "Short url lookups coalesced into a concurrent lookup of the same short url.",
+	})
+
+	// ShortenRequests counts the shorten requests by api version and outcome (success, failure).
+	ShortenRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shorten_requests_total",
+		Help:      "Shorten requests by api version and outcome.",
+	}, []string{"version", "outcome"})
+
+	// RateLimitRejections counts the requests throttled by the rate limiter.
+	RateLimitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter.",
+	})
+
+	// BloomFalsePositives counts the aliases reported taken by the bloom filter,
+	// but found free in the database.
+	BloomFalsePositives = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bloom_false_positives_total",
+		Help:      "Aliases reported by the bloom filter but missing from the database.",
+	})
+
+	// BackgroundJobRuns counts the runs of the background jobs by job and outcome (success, failure).
+	BackgroundJobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "background_job_runs_total",
+		Help:      "Background job runs by job and outcome.",
+	}, []string{"job", "outcome"})
+)
+
+// Outcome helps to label an error as success or failure.
+func Outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// BloomFilterStats is implemented by the bloom filters exposing their saturation.
+type BloomFilterStats interface {
+	FillRatio() float64
+	EstimatedFalsePositiveRate() float64
+}
+
+// RegisterBloomFilter helps to expose the fill ratio and the estimated false positive rate of the bloom filter.
+func RegisterBloomFilter(bf BloomFilterStats) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bloom_filter_fill_ratio",
+		Help:      "Ratio of the bits set in the bloom filter.",
+	}, bf.FillRatio)
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bloom_filter_estimated_false_positive_rate",
+		Help:      "Estimated false positive rate of the bloom filter.",
+	}, bf.EstimatedFalsePositiveRate)
+}
+
+// RegisterDB helps to expose the connection pool stats of the database.
+func RegisterDB(db *sql.DB, dbName string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// Handler returns the http handler serving the metrics in the prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
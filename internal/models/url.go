@@ -11,3 +11,54 @@ type Url struct {
 	CreatedAt    time.Time `json:"created_at"`
 	ExpirationAt time.Time `json:"expiration_at"`
 }
+
+// TopLink is a single entry of the top links leaderboard.
+//
+// WindowHits are the human hits inside the requested window and
+// PreviousWindowHits the ones in the window right before it, which
+// drives the Velocity (hits per hour) and Growth of the link.
+type TopLink struct {
+	ShortURL           string  `json:"short_url"`
+	OriginalURL        string  `json:"original_url"`
+	Hits               int     `json:"hits"`
+	WindowHits         int     `json:"window_hits"`
+	PreviousWindowHits int     `json:"previous_window_hits"`
+	Velocity           float64 `json:"velocity"`
+	Growth             float64 `json:"growth"`
+}
+
+// ClickEvent is a single redirect of a short url, streamed to the live dashboards.
+type ClickEvent struct {
+	ShortURL string    `json:"short_url"`
+	Time     time.Time `json:"time"`
+	Country  string    `json:"country"`
+	Referrer string    `json:"referrer"`
+	Device   string    `json:"device"`
+	IsBot    bool      `json:"is_bot"`
+}
+
+// DailyStat holds the hits of a short url for a single day (UTC).
+type DailyStat struct {
+	Day     time.Time `json:"day"`
+	Hits    int       `json:"hits"`
+	BotHits int       `json:"bot_hits"`
+}
+
+// HotKey is a short url detected hot by the redirect path.
+// EstimatedHits are the recent hits, decayed over time.
+type HotKey struct {
+	ShortURL      string    `json:"short_url"`
+	EstimatedHits uint32    `json:"estimated_hits"`
+	PromotedAt    time.Time `json:"promoted_at"`
+	Pinned        bool      `json:"pinned"`
+}
+
+// AliasAvailability is the outcome of checking a custom alias.
+// Reason (taken, reserved, invalid) and Suggestions are only set when not available.
+type AliasAvailability struct {
+	Alias       string   `json:"alias"`
+	Available   bool     `json:"available"`
+	Reason      string   `json:"reason,omitempty"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -17,6 +21,8 @@ import (
 	"github.com/sounishnath003/url-shortner-service-golang/internal/handlers"
 	v1 "github.com/sounishnath003/url-shortner-service-golang/internal/handlers/v1"
 	v2 "github.com/sounishnath003/url-shortner-service-golang/internal/handlers/v2"
+	"github.com/sounishnath003/url-shortner-service-golang/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/time/rate"
 )
 
@@ -39,16 +45,28 @@ func (s *Server) Run() error {
 
 	// Adding the health endpoint.
 	mux.HandleFunc("/api/healthy", HealthHandler)
+	mux.HandleFunc("GET /api/ready", ReadyHandler)
+	// Adding the prometheus metrics endpoint.
+	mux.Handle("GET /metrics", metrics.Handler())
 
 	// Auth endpoints.
 	mux.HandleFunc("POST /login", handlers.LoginHandler)
 	mux.HandleFunc("POST /signup", handlers.SignupHandler)
 
 	// Groupping versioning.
-	mux.HandleFunc("POST /api/v1/shorten", s.AuthGuardMiddleware(v1.GenerateUrlShortenerHandler))
+	mux.HandleFunc("POST /api/v1/shorten", s.AuthGuardMiddleware(s.IdempotencyMiddleware(s.ShortenMetricsMiddleware("v1", v1.GenerateUrlShortenerHandler))))
 
 	// Groupping /api/v2 endpoints.
-	mux.HandleFunc("POST /api/v2/shorten", s.AuthGuardMiddleware(v2.GenerateUrlShortenerHandler))
+	mux.HandleFunc("POST /api/v2/shorten", s.AuthGuardMiddleware(s.IdempotencyMiddleware(s.ShortenMetricsMiddleware("v2", v2.GenerateUrlShortenerHandler))))
+	mux.HandleFunc("GET /api/v2/links/top", s.AuthGuardMiddleware(v2.TopLinksHandler))
+	mux.HandleFunc("GET /api/v2/links/{alias}/live", s.AuthGuardMiddleware(v2.LiveClicksHandler))
+	mux.HandleFunc("GET /api/v2/links/{alias}/stats", s.AuthGuardMiddleware(v2.UrlStatsHandler))
+
+	// Admin endpoints.
+	mux.HandleFunc("GET /api/admin/hot-keys", s.AuthGuardMiddleware(s.AdminGuardMiddleware(handlers.HotKeysHandler)))
+	mux.HandleFunc("GET /api/admin/bloom", s.AuthGuardMiddleware(s.AdminGuardMiddleware(handlers.BloomFilterInfoHandler)))
+	mux.HandleFunc("POST /api/admin/bloom/rebuild", s.AuthGuardMiddleware(s.AdminGuardMiddleware(handlers.BloomFilterRebuildHandler)))
+	mux.HandleFunc("GET /api/admin/shortcodes/{code}", s.AuthGuardMiddleware(s.AdminGuardMiddleware(handlers.DecodeShortCodeHandler)))
 
 	// Required routes for the services
 	mux.HandleFunc("GET /{shortenUrl}", handlers.GetShortenUrlHandler)
@@ -57,7 +75,17 @@ func (s *Server) Run() error {
 	hostAddr := fmt.Sprintf("http://0.0.0.0:%d", s.port)
 	s.co.Lo.Info("server has been up and running", "on", hostAddr)
 	return http.ListenAndServe(fmt.Sprintf(":%d", s.port),
-		s.LoggerMiddleware(s.RateLimiterMiddleware(s.CustomReqContextMiddleware(mux))),
+		s.TracingMiddleware(s.LoggerMiddleware(s.RateLimiterMiddleware(s.CustomReqContextMiddleware(mux)))),
+	)
+}
+
+// TracingMiddleware helps to start a server span for every request received.
+// Continues the trace of the caller when the W3C traceparent header is provided.
+func (s *Server) TracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return "HTTP " + r.Method
+		}),
 	)
 }
 
@@ -137,6 +165,7 @@ func (s *Server) RateLimiterMiddleware(next http.Handler) http.HandlerFunc {
 
 			// Log the client information for audit trails
 			s.co.Lo.Info("client", ip, "has been throttle due to too many requests", "lastSeen", clients[ip].lastSeen)
+			metrics.RateLimitRejections.Inc()
 
 			w.Header().Add("X-Rate-Limiter", time.Now().Format(time.RFC3339Nano))
 			w.Header().Add("Content-Type", "application/json, charset=utf-8")
@@ -158,6 +187,117 @@ func (s *Server) RateLimiterMiddleware(next http.Handler) http.HandlerFunc {
 	}
 }
 
+// statusRecorder helps to capture the status code written by the handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// idempotencyRecorder helps to capture the response written by the handlers, to replay it.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (ir *idempotencyRecorder) WriteHeader(status int) {
+	ir.status = status
+	ir.ResponseWriter.WriteHeader(status)
+}
+
+func (ir *idempotencyRecorder) Write(b []byte) (int, error) {
+	ir.body.Write(b)
+	return ir.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware helps to run a request at most once per Idempotency-Key header of the user.
+//
+// The response of the first request is recorded, and replayed to the retries
+// carrying the same key and body (Idempotent-Replayed header). A key reused with
+// another request throws 409-Conflict, so does a retry while the first request
+// is still running. The server errors are not recorded, their retries run again.
+// Requests without the header run as usual.
+func (s *Server) IdempotencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if len(key) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			handlers.WriteError(w, http.StatusBadRequest, errors.New("Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		// Fingerprint the request, so the key can not be reused with another one.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			handlers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		userID := r.Context().Value("userID").(int)
+		replay, err := s.co.ClaimIdempotencyKey(r.Context(), userID, key, requestHash)
+		if errors.Is(err, core.ErrIdempotencyKeyReused) || errors.Is(err, core.ErrIdempotencyKeyInProgress) {
+			handlers.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			s.co.Lo.Error("unable to claim the idempotency key", "key", key, "error", err)
+			handlers.WriteError(w, http.StatusInternalServerError, errors.New("unable to claim the idempotency key"))
+			return
+		}
+		if replay != nil {
+			w.Header().Add("Content-Type", "application/json, charset=utf-8")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(replay.Status)
+			w.Write(replay.Body)
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Record the response, even when the client went away meanwhile.
+		ctx := context.WithoutCancel(r.Context())
+		if recorder.status >= http.StatusInternalServerError {
+			err = s.co.ReleaseIdempotencyKey(ctx, userID, key)
+		} else {
+			err = s.co.SaveIdempotentResponse(ctx, userID, key, core.IdempotentResponse{
+				Status: recorder.status,
+				Body:   recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			s.co.Lo.Error("unable to record the idempotent response", "key", key, "error", err)
+		}
+	}
+}
+
+// ShortenMetricsMiddleware helps to count the shorten requests of the api version by their outcome.
+func (s *Server) ShortenMetricsMiddleware(version string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		outcome := "success"
+		if recorder.status >= http.StatusBadRequest {
+			outcome = "failure"
+		}
+		metrics.ShortenRequests.WithLabelValues(version, outcome).Inc()
+	}
+}
+
 // CustomReqContextMiddleware helps to feed the custom request context into the request context default channel.
 // Which will inject the *core.Core dependencies execution in the handlers endpoints business logic.
 func (s *Server) CustomReqContextMiddleware(next http.Handler) http.HandlerFunc {
@@ -179,15 +319,56 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Still serving while degraded, the redirects fall back to the healthy tier.
+	status, message := "OK", "api services are normal"
+	healthy, breakers := co.HealthInfo()
+	if !healthy {
+		status, message = "DEGRADED", "api services are degraded"
+	}
+
 	handlers.WriteJson(w, http.StatusOK, map[string]any{
-		"status":    "OK",
+		"status":    status,
 		"version":   co.Version,
-		"message":   "api services are normal",
+		"message":   message,
 		"hostname":  hostname,
+		"breakers":  breakers,
 		"timestamp": time.Now(),
 	})
 }
 
+// ReadyHandler works as a readiness check endpoint for the api.
+// Not ready until the bloom filter knows every existing short url.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	co := r.Context().Value("co").(*core.Core)
+
+	if !co.BloomFilterLoaded() {
+		handlers.WriteJson(w, http.StatusServiceUnavailable, map[string]any{
+			"status":  "NOT_READY",
+			"message": "bloom filter is still loading",
+		})
+		return
+	}
+
+	handlers.WriteJson(w, http.StatusOK, map[string]any{
+		"status":  "READY",
+		"message": "api services are ready",
+	})
+}
+
+// AdminGuardMiddleware helps to restrict the request to the admin users.
+// Must be wrapped by the AuthGuardMiddleware.
+func (s *Server) AdminGuardMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userEmail := r.Context().Value("userEmail").(string)
+		if !s.co.IsAdmin(userEmail) {
+			s.co.Lo.Info("admin.middleware checks", "remoteIp", r.RemoteAddr, "isAdmin", false)
+			handlers.WriteError(w, http.StatusForbidden, errors.New("Forbidden"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
 // AuthGuardMiddleware helps to authenticate the request.
 // It checks the authorization header and verifies the JWT token.
 // If the token is valid, the request is allowed to proceed.
@@ -211,7 +392,7 @@ func (s *Server) AuthGuardMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		token := splits[1]
 
-		userID, foundEmail, err := s.ClaimAndVerifyJwtToken(token)
+		userID, foundEmail, err := s.ClaimAndVerifyJwtToken(r.Context(), token)
 		if err != nil {
 			s.co.Lo.Info("auth.middleware checks", "remoteIp", r.RemoteAddr, "isAuthorized", false)
 			handlers.WriteError(w, http.StatusUnauthorized, err)
@@ -233,7 +414,7 @@ func (s *Server) AuthGuardMiddleware(next http.HandlerFunc) http.HandlerFunc {
 // If the token is invalid, it returns an error.
 //
 // Return userID, userEmail, error
-func (s *Server) ClaimAndVerifyJwtToken(token string) (int, string, error) {
+func (s *Server) ClaimAndVerifyJwtToken(ctx context.Context, token string) (int, string, error) {
 	// Parse the JWT token.
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.co.JwtSecret), nil
@@ -256,7 +437,7 @@ func (s *Server) ClaimAndVerifyJwtToken(token string) (int, string, error) {
 	userID := 0
 	foundEmail := ""
 	foundPass := ""
-	s.co.QueryStmts.GetUserByEmail.QueryRow(email).Scan(&userID, &foundEmail, &foundPass)
+	s.co.QueryStmts.GetUserByEmail.QueryRowContext(ctx, email).Scan(&userID, &foundEmail, &foundPass)
 	if foundEmail == "" || foundPass == "" {
 		return 0, "", errors.New("Unauthorized")
 	}
@@ -0,0 +1,111 @@
+package shortcode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// feistelRounds number of rounds of the permutation. 4 rounds of a
+// pseudorandom function make a pseudorandom permutation.
+const feistelRounds = 4
+
+// ErrOutOfRange is returned when permuting a value out of the domain of the permutation.
+var ErrOutOfRange = errors.New("value is out of the range of the permutation")
+
+// Permutation is a keyed bijection over the values of bits bits, mapping the
+// sequential ids to random looking ones, so the short codes of the sequence
+// can not be enumerated. Being a bijection, two ids never collide and every
+// permuted value can be inverted back to its id with the key.
+//
+// It is a balanced Feistel network with a HMAC-SHA256 round function, over
+// the smallest even number of bits holding the domain. The values landing
+// out of the domain are permuted again (cycle walking) until they fit.
+type Permutation struct {
+	key      []byte
+	bits     uint
+	halfBits uint
+	halfMask uint64
+}
+
+// NewPermutation helps to create the permutation of the values of bits bits (2 to 64) keyed with key.
+func NewPermutation(key string, bits int) (*Permutation, error) {
+	if len(key) == 0 {
+		return nil, errors.New("permutation key must not be empty")
+	}
+	if bits < 2 || bits > 64 {
+		return nil, fmt.Errorf("permutation bits must be 2 to 64: %d", bits)
+	}
+
+	halfBits := uint(bits+1) / 2
+	return &Permutation{
+		key:      []byte(key),
+		bits:     uint(bits),
+		halfBits: halfBits,
+		halfMask: 1<<halfBits - 1,
+	}, nil
+}
+
+// Bits returns the number of bits of the values of the domain.
+func (p *Permutation) Bits() int {
+	return int(p.bits)
+}
+
+// Permute returns the permuted value of the id.
+func (p *Permutation) Permute(id uint64) (uint64, error) {
+	if !p.inDomain(id) {
+		return 0, ErrOutOfRange
+	}
+	for {
+		id = p.encrypt(id)
+		if p.inDomain(id) {
+			return id, nil
+		}
+	}
+}
+
+// Invert returns the id of the permuted value.
+func (p *Permutation) Invert(value uint64) (uint64, error) {
+	if !p.inDomain(value) {
+		return 0, ErrOutOfRange
+	}
+	for {
+		value = p.decrypt(value)
+		if p.inDomain(value) {
+			return value, nil
+		}
+	}
+}
+
+func (p *Permutation) inDomain(value uint64) bool {
+	return p.bits == 64 || value>>p.bits == 0
+}
+
+func (p *Permutation) encrypt(value uint64) uint64 {
+	left, right := value>>p.halfBits&p.halfMask, value&p.halfMask
+	for round := range feistelRounds {
+		left, right = right, left^p.round(round, right)
+	}
+	return left<<p.halfBits | right
+}
+
+func (p *Permutation) decrypt(value uint64) uint64 {
+	left, right := value>>p.halfBits&p.halfMask, value&p.halfMask
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^p.round(round, left), left
+	}
+	return left<<p.halfBits | right
+}
+
+// round is the keyed round function, HMAC-SHA256(key, round || half).
+func (p *Permutation) round(round int, half uint64) uint64 {
+	var msg [9]byte
+	msg[0] = byte(round)
+	binary.BigEndian.PutUint64(msg[1:], half)
+
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)) & p.halfMask
+}
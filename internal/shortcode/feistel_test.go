@@ -0,0 +1,105 @@
+package shortcode
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"testing/quick"
+)
+
+// TestPermutationBijection checks every value of small domains is reached
+// exactly once, and inverts back to its id.
+func TestPermutationBijection(t *testing.T) {
+	for _, bits := range []int{2, 3, 8, 11, 16} {
+		p, err := NewPermutation("test-key", bits)
+		if err != nil {
+			t.Fatalf("unable to create the permutation: %v", err)
+		}
+
+		domain := uint64(1) << bits
+		seen := make([]bool, domain)
+		for id := range domain {
+			value, err := p.Permute(id)
+			if err != nil {
+				t.Fatalf("bits %d: unable to permute %d: %v", bits, id, err)
+			}
+			if value >= domain {
+				t.Fatalf("bits %d: %d is permuted out of the domain: %d", bits, id, value)
+			}
+			if seen[value] {
+				t.Fatalf("bits %d: %d is permuted to the value of another id: %d", bits, id, value)
+			}
+			seen[value] = true
+
+			if inverted, err := p.Invert(value); err != nil || inverted != id {
+				t.Fatalf("bits %d: %d inverts to %d (%v), want %d", bits, value, inverted, err, id)
+			}
+		}
+	}
+}
+
+// TestPermutationRoundTrip checks the ids of large domains invert back.
+func TestPermutationRoundTrip(t *testing.T) {
+	for _, bits := range []int{40, 63, 64} {
+		p, err := NewPermutation("test-key", bits)
+		if err != nil {
+			t.Fatalf("unable to create the permutation: %v", err)
+		}
+
+		roundTrip := func(id uint64) bool {
+			if bits < 64 {
+				id &= 1<<bits - 1
+			}
+			value, err := p.Permute(id)
+			if err != nil || !p.inDomain(value) {
+				return false
+			}
+			inverted, err := p.Invert(value)
+			return err == nil && inverted == id
+		}
+		if err := quick.Check(roundTrip, &quick.Config{MaxCount: 2000}); err != nil {
+			t.Errorf("bits %d: %v", bits, err)
+		}
+	}
+}
+
+// TestPermutationKey checks the permutation depends on the key.
+func TestPermutationKey(t *testing.T) {
+	p1, _ := NewPermutation("key-1", 40)
+	p2, _ := NewPermutation("key-2", 40)
+
+	same := 0
+	for id := range uint64(100) {
+		v1, _ := p1.Permute(id)
+		v2, _ := p2.Permute(id)
+		if v1 == v2 {
+			same++
+		}
+	}
+	if same > 1 {
+		t.Errorf("%d ids of 100 are permuted the same with different keys", same)
+	}
+}
+
+// TestPermutationErrors checks the invalid permutations and the values out of the domain are rejected.
+func TestPermutationErrors(t *testing.T) {
+	if _, err := NewPermutation("", 40); err == nil {
+		t.Error("empty key must be rejected")
+	}
+	for _, bits := range []int{-1, 0, 1, 65} {
+		if _, err := NewPermutation("test-key", bits); err == nil {
+			t.Errorf("%d bits must be rejected", bits)
+		}
+	}
+
+	p, err := NewPermutation("test-key", 40)
+	if err != nil {
+		t.Fatalf("unable to create the permutation: %v", err)
+	}
+	if _, err := p.Permute(1 << 40); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("permuting 1<<40 returned %v, want %v", err, ErrOutOfRange)
+	}
+	if _, err := p.Invert(math.MaxUint64); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("inverting max uint64 returned %v, want %v", err, ErrOutOfRange)
+	}
+}
@@ -0,0 +1,124 @@
+package shortcode
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Alphabets of the short codes.
+const (
+	// Base62 digits, then lower and upper case letters.
+	Base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// Unambiguous is Base62 without the characters easily mistaken for one another (0/O, 1/l/I).
+	Unambiguous = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+var (
+	// ErrInvalidCode is returned when decoding a code with characters out of the alphabet.
+	ErrInvalidCode = errors.New("short code has characters out of the alphabet")
+	// ErrOverflow is returned when decoding a code too large for an id.
+	ErrOverflow = errors.New("short code overflows the id")
+)
+
+// Codec encodes the ids into short codes made of the characters of its
+// alphabet, and decodes them back.
+//
+// The codes are the ids written in base len(alphabet), left padded with the
+// first character of the alphabet (the zero digit) up to the minimum length.
+// The padding does not change the value, so every code decodes to its id.
+type Codec struct {
+	alphabet  string
+	base      uint64
+	minLength int
+	digits    [256]int16 // value of every character, -1 when out of the alphabet
+}
+
+// New helps to create a codec for the alphabet, padding the codes to minLength.
+// The alphabet must have at least 2 unique url safe (letters, digits, '-', '_') characters.
+func New(alphabet string, minLength int) (*Codec, error) {
+	if len(alphabet) < 2 {
+		return nil, fmt.Errorf("alphabet must have at least 2 characters: %q", alphabet)
+	}
+
+	c := &Codec{
+		alphabet:  alphabet,
+		base:      uint64(len(alphabet)),
+		minLength: max(minLength, 0),
+	}
+	for i := range c.digits {
+		c.digits[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		char := alphabet[i]
+		if !isUrlSafe(char) {
+			return nil, fmt.Errorf("alphabet has a character which is not url safe: %q", char)
+		}
+		if c.digits[char] >= 0 {
+			return nil, fmt.Errorf("alphabet has a duplicate character: %q", char)
+		}
+		c.digits[char] = int16(i)
+	}
+
+	return c, nil
+}
+
+// Alphabet returns the characters of the codes.
+func (c *Codec) Alphabet() string {
+	return c.alphabet
+}
+
+// MinLength returns the length the codes are padded to.
+func (c *Codec) MinLength() int {
+	return c.minLength
+}
+
+// Encode returns the short code of the id.
+func (c *Codec) Encode(id uint64) string {
+	// 64 digits is the longest code, in base 2.
+	var buf [64]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = c.alphabet[id%c.base]
+		id /= c.base
+		if id == 0 {
+			break
+		}
+	}
+
+	code := string(buf[i:])
+	if len(code) < c.minLength {
+		code = strings.Repeat(c.alphabet[:1], c.minLength-len(code)) + code
+	}
+	return code
+}
+
+// Decode returns the id of the short code.
+func (c *Codec) Decode(code string) (uint64, error) {
+	if len(code) == 0 {
+		return 0, ErrInvalidCode
+	}
+
+	var id uint64
+	for i := 0; i < len(code); i++ {
+		digit := c.digits[code[i]]
+		if digit < 0 {
+			return 0, ErrInvalidCode
+		}
+		if id > (math.MaxUint64-uint64(digit))/c.base {
+			return 0, ErrOverflow
+		}
+		id = id*c.base + uint64(digit)
+	}
+	return id, nil
+}
+
+// isUrlSafe reports whether the character can be used in a path segment as is.
+func isUrlSafe(char byte) bool {
+	return char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' ||
+		char >= '0' && char <= '9' ||
+		char == '-' || char == '_'
+}
@@ -0,0 +1,106 @@
+package shortcode
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func newCodec(t *testing.T, alphabet string, minLength int) *Codec {
+	t.Helper()
+	c, err := New(alphabet, minLength)
+	if err != nil {
+		t.Fatalf("unable to create the codec: %v", err)
+	}
+	return c
+}
+
+// TestRoundTrip checks every id decodes back from its code, for both the
+// alphabets and several minimum lengths.
+func TestRoundTrip(t *testing.T) {
+	for _, alphabet := range []string{Base62, Unambiguous} {
+		for _, minLength := range []int{0, 1, 6, 12} {
+			c := newCodec(t, alphabet, minLength)
+
+			roundTrip := func(id uint64) bool {
+				code := c.Encode(id)
+				if len(code) < minLength {
+					return false
+				}
+				decoded, err := c.Decode(code)
+				return err == nil && decoded == id
+			}
+			if err := quick.Check(roundTrip, &quick.Config{MaxCount: 5000}); err != nil {
+				t.Errorf("alphabet %q, min length %d: %v", alphabet, minLength, err)
+			}
+			for _, id := range []uint64{0, 1, c.base - 1, c.base, math.MaxUint64} {
+				if !roundTrip(id) {
+					t.Errorf("alphabet %q, min length %d: id %d does not round trip", alphabet, minLength, id)
+				}
+			}
+		}
+	}
+}
+
+// TestEncodePadding checks the codes are padded with the zero digit.
+func TestEncodePadding(t *testing.T) {
+	c := newCodec(t, Base62, 6)
+
+	if code := c.Encode(0); code != "000000" {
+		t.Errorf("code of 0 is %q, want %q", code, "000000")
+	}
+	if code := c.Encode(62); code != "000010" {
+		t.Errorf("code of 62 is %q, want %q", code, "000010")
+	}
+	if code := c.Encode(math.MaxUint64); code != "lYGhA16ahyf" {
+		t.Errorf("code of max uint64 is %q, want %q", code, "lYGhA16ahyf")
+	}
+}
+
+// TestNewErrors checks the invalid alphabets are rejected.
+func TestNewErrors(t *testing.T) {
+	for name, alphabet := range map[string]string{
+		"empty":          "",
+		"single":         "a",
+		"not url safe":   "abc/",
+		"space":          "ab c",
+		"not ascii":      "abcé",
+		"duplicate":      "abca",
+		"duplicate case": "0123456789abcdefa",
+	} {
+		if _, err := New(alphabet, 6); err == nil {
+			t.Errorf("%s alphabet %q must be rejected", name, alphabet)
+		}
+	}
+
+	// A negative min length means no padding.
+	c := newCodec(t, "-_", -1)
+	if c.MinLength() != 0 {
+		t.Errorf("min length is %d, want 0", c.MinLength())
+	}
+}
+
+// TestDecodeErrors checks the invalid and overflowing codes are rejected.
+func TestDecodeErrors(t *testing.T) {
+	c := newCodec(t, Base62, 6)
+
+	for _, code := range []string{"", "abc!", "abc def", "0O0/", "é"} {
+		if _, err := c.Decode(code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("decoding %q returned %v, want %v", code, err, ErrInvalidCode)
+		}
+	}
+
+	// One past the max uint64 ("lYGhA16ahyf"), and a longer code.
+	for _, code := range []string{"lYGhA16ahyg", "zzzzzzzzzzzz", strings.Repeat("1", 64)} {
+		if _, err := c.Decode(code); !errors.Is(err, ErrOverflow) {
+			t.Errorf("decoding %q returned %v, want %v", code, err, ErrOverflow)
+		}
+	}
+
+	// The padding does not count towards the overflow.
+	if id, err := c.Decode(strings.Repeat("0", 20) + "lYGhA16ahyf"); err != nil || id != math.MaxUint64 {
+		t.Errorf("decoding the padded max uint64 returned %d, %v", id, err)
+	}
+}
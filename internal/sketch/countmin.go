@@ -0,0 +1,80 @@
+package sketch
+
+import (
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// CountMin is a count-min sketch, estimating the frequency of the keys added
+// in a fixed amount of memory. The estimate never under counts a key, and over
+// counts it by at most epsilon * total count with a probability of 1 - delta.
+//
+// The counters are updated atomically, so the sketch can be shared by the
+// request handlers without any lock. Decay halves every counter, so the sketch
+// favours the recent activity over the lifetime one.
+type CountMin struct {
+	width    uint64
+	depth    uint64
+	counters []uint32 // depth rows of width counters
+}
+
+// NewCountMin helps to create a new count-min sketch with the given error bounds.
+// e.g. NewCountMin(0.001, 0.01) over counts by at most 0.1% of the total count,
+// 99% of the time.
+func NewCountMin(epsilon, delta float64) *CountMin {
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := uint64(math.Ceil(math.Log(1 / delta)))
+
+	return &CountMin{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint32, width*depth),
+	}
+}
+
+// Add counts one occurrence of the key and returns its estimated count.
+func (s *CountMin) Add(key string) uint32 {
+	h1, h2 := hashes(key)
+
+	estimate := uint32(math.MaxUint32)
+	for i := uint64(0); i < s.depth; i++ {
+		index := i*s.width + (h1+i*h2)%s.width
+		estimate = min(estimate, atomic.AddUint32(&s.counters[index], 1))
+	}
+	return estimate
+}
+
+// Estimate returns the estimated count of the key.
+func (s *CountMin) Estimate(key string) uint32 {
+	h1, h2 := hashes(key)
+
+	estimate := uint32(math.MaxUint32)
+	for i := uint64(0); i < s.depth; i++ {
+		index := i*s.width + (h1+i*h2)%s.width
+		estimate = min(estimate, atomic.LoadUint32(&s.counters[index]))
+	}
+	return estimate
+}
+
+// Decay halves every counter. The increments racing with the decay may be
+// halved or not, which is fine for an estimate.
+func (s *CountMin) Decay() {
+	for i := range s.counters {
+		for {
+			count := atomic.LoadUint32(&s.counters[i])
+			if count == 0 || atomic.CompareAndSwapUint32(&s.counters[i], count, count/2) {
+				break
+			}
+		}
+	}
+}
+
+// hashes returns the two halves of the 64 bit FNV-1a hash of the key, used
+// for the double hashing of the rows (Kirsch-Mitzenmacher).
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & math.MaxUint32, (sum >> 32) | 1
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the service.
+const instrumentationName = "github.com/sounishnath003/url-shortner-service-golang"
+
+// Init helps to set up the global tracer provider and the W3C trace-context propagator.
+//
+// The exporter can be:
+// - otlp: OTLP over http, configured by the standard OTEL_EXPORTER_OTLP_* env (default localhost:4318)
+// - stdout: pretty prints the spans, handy for the local development
+// - none: spans are neither recorded nor exported
+//
+// The sampler is configured by the standard OTEL_TRACES_SAMPLER* env.
+//
+// Returns the shutdown func flushing the pending spans, caller must call it before exiting.
+func Init(ctx context.Context, exporter, serviceName, version string) (func(context.Context) error, error) {
+	// Always propagate the trace context, so the upstream traces are continued
+	// even when the spans are not exported by this service.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(ctx)
+	case "stdout", "console":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown traces exporter: %s", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
@@ -0,0 +1,183 @@
+package traffic
+
+import (
+	"net/http"
+	"strings"
+)
+
+// botSignatures are lowercased user agent fragments of well known crawlers,
+// link unfurlers, uptime checkers and scripted http clients.
+//
+// Matching is a plain substring check, so keep the fragments specific enough
+// to not catch regular browsers.
+var botSignatures = []string{
+	"bot",
+	"crawler",
+	"spider",
+	"slurp",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"slackbot",
+	"slack-imgproxy",
+	"twitterbot",
+	"discordbot",
+	"telegrambot",
+	"linkedinbot",
+	"skypeuripreview",
+	"embedly",
+	"pinterestbot",
+	"bingpreview",
+	"googleimageproxy",
+	"google-read-aloud",
+	"uptimerobot",
+	"pingdom",
+	"statuscake",
+	"site24x7",
+	"datadog",
+	"newrelicpinger",
+	"betteruptime",
+	"headlesschrome",
+	"phantomjs",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"python-urllib",
+	"go-http-client",
+	"okhttp",
+	"java/",
+	"libwww-perl",
+	"httpclient",
+}
+
+// previewSignatures are lowercased user agent fragments shared by the link
+// previewers and the in-app browsers of the same apps. Only a user agent
+// without any browser engine is the previewer.
+var previewSignatures = []string{
+	"whatsapp/",
+}
+
+// browserEngines are lowercased user agent fragments of the browser engines.
+var browserEngines = []string{
+	"applewebkit",
+	"gecko/",
+	"chrome/",
+}
+
+// prefetchHeaders are the request headers browsers and proxies send when the
+// link is only being fetched ahead of time and not actually clicked.
+var prefetchHeaders = map[string][]string{
+	"Purpose":     {"prefetch", "preview"},
+	"Sec-Purpose": {"prefetch", "prerender"},
+	"X-Purpose":   {"prefetch", "preview"},
+	"X-Moz":       {"prefetch"},
+}
+
+// Classification is the outcome of classifying a request.
+type Classification struct {
+	IsBot  bool
+	Reason string
+}
+
+// Classify helps to identify whether the request has been made by a human or
+// by automated traffic (crawlers, unfurlers, monitors, prefetchers).
+//
+// The redirect is served regardless of the result. Only the accounting of the
+// click differs, so a false positive never breaks a link.
+func Classify(r *http.Request) Classification {
+	// HEAD requests never come from a human clicking the link.
+	if r.Method == http.MethodHead {
+		return Classification{IsBot: true, Reason: "method:" + r.Method}
+	}
+
+	for header, values := range prefetchHeaders {
+		headerValue := strings.ToLower(r.Header.Get(header))
+		if len(headerValue) == 0 {
+			continue
+		}
+		for _, value := range values {
+			if strings.Contains(headerValue, value) {
+				return Classification{IsBot: true, Reason: "header:" + header}
+			}
+		}
+	}
+
+	userAgent := strings.ToLower(r.UserAgent())
+	if len(userAgent) == 0 {
+		return Classification{IsBot: true, Reason: "ua:empty"}
+	}
+
+	for _, signature := range botSignatures {
+		if strings.Contains(userAgent, signature) {
+			return Classification{IsBot: true, Reason: "ua:" + signature}
+		}
+	}
+	for _, signature := range previewSignatures {
+		if strings.Contains(userAgent, signature) && !hasBrowserEngine(userAgent) {
+			return Classification{IsBot: true, Reason: "ua:" + signature}
+		}
+	}
+
+	return Classification{IsBot: false, Reason: "human"}
+}
+
+// hasBrowserEngine reports whether the lowercased user agent is the one of a browser.
+func hasBrowserEngine(userAgent string) bool {
+	for _, engine := range browserEngines {
+		if strings.Contains(userAgent, engine) {
+			return true
+		}
+	}
+	return false
+}
+
+// Device families reported by Device.
+const (
+	DeviceBot     = "bot"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceUnknown = "unknown"
+)
+
+// Device helps to derive the device family from the user agent.
+func Device(r *http.Request, visit Classification) string {
+	if visit.IsBot {
+		return DeviceBot
+	}
+
+	userAgent := strings.ToLower(r.UserAgent())
+	switch {
+	case strings.Contains(userAgent, "ipad") || strings.Contains(userAgent, "tablet") ||
+		(strings.Contains(userAgent, "android") && !strings.Contains(userAgent, "mobile")):
+		return DeviceTablet
+	case strings.Contains(userAgent, "mobi") || strings.Contains(userAgent, "iphone") ||
+		strings.Contains(userAgent, "android"):
+		return DeviceMobile
+	case strings.Contains(userAgent, "windows") || strings.Contains(userAgent, "macintosh") ||
+		strings.Contains(userAgent, "linux") || strings.Contains(userAgent, "cros"):
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+// countryHeaders are the headers set by the CDNs / load balancers in front of
+// the service carrying the ISO country code of the client.
+var countryHeaders = []string{
+	"CF-IPCountry",
+	"CloudFront-Viewer-Country",
+	"X-Appengine-Country",
+	"X-Country-Code",
+}
+
+// Country helps to find the ISO country code of the client, as resolved by the
+// edge in front of the service. Returns "unknown" when not available.
+func Country(r *http.Request) string {
+	for _, header := range countryHeaders {
+		country := strings.ToUpper(strings.TrimSpace(r.Header.Get(header)))
+		// Cloudflare reports XX when the country is unknown.
+		if len(country) == 2 && country != "XX" {
+			return country
+		}
+	}
+	return "unknown"
+}
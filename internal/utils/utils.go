@@ -3,6 +3,9 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GetEnv Returns the value of the environment variable with the given key.
@@ -15,3 +18,75 @@ func GetEnv(key string, fallback any) any {
 	fmt.Println(key, " not found from env, settting fallback value.")
 	return fallback
 }
+
+// GetEnvInt Returns the integer value of the environment variable with the given key.
+// If the environment variable is not set or not a valid integer, it returns the fallback value.
+func GetEnvInt(key string, fallback int) int {
+	value, ok := GetEnv(key, fallback).(string)
+	if !ok {
+		return fallback
+	}
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Println(key, " is not a valid integer, settting fallback value.")
+		return fallback
+	}
+	return num
+}
+
+// GetEnvDuration Returns the time.Duration value (ex: 30s, 5m, 1h) of the environment variable with the given key.
+// If the environment variable is not set or not a valid duration, it returns the fallback value.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := GetEnv(key, fallback).(string)
+	if !ok {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Println(key, " is not a valid duration, settting fallback value.")
+		return fallback
+	}
+	return duration
+}
+
+// GetEnvFloat Returns the float value of the environment variable with the given key.
+// If the environment variable is not set or not a valid float, it returns the fallback value.
+func GetEnvFloat(key string, fallback float64) float64 {
+	value, ok := GetEnv(key, fallback).(string)
+	if !ok {
+		return fallback
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Println(key, " is not a valid float, settting fallback value.")
+		return fallback
+	}
+	return num
+}
+
+// GetEnvBool Returns the boolean value (true, false, 1, 0) of the environment variable with the given key.
+// If the environment variable is not set or not a valid boolean, it returns the fallback value.
+func GetEnvBool(key string, fallback bool) bool {
+	value, ok := GetEnv(key, fallback).(string)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Println(key, " is not a valid boolean, settting fallback value.")
+		return fallback
+	}
+	return b
+}
+
+// GetEnvList Returns the comma separated values of the environment variable with the given key.
+// If the environment variable is not set, it returns an empty list.
+func GetEnvList(key string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(GetEnv(key, "").(string), ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,91 @@
+-- Upgrades the databases created by the previous init.sql to its current schema.
+-- init.sql drops the tables first, so run this one on the existing deployments instead:
+--     psql "$DSN" -f migrate.sql
+-- Every statement is safe to run again.
+BEGIN;
+
+-- Url mappings
+ALTER TABLE url_mappings
+    ALTER COLUMN short_url DROP NOT NULL; -- NULL once the alias has been reclaimed
+
+ALTER TABLE url_mappings
+    ADD COLUMN IF NOT EXISTS reclaimed_short_url VARCHAR(20), -- alias of the expired short url, before its reclaim
+    ADD COLUMN IF NOT EXISTS bot_hit_count INT DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS url_mappings_expiration_at_idx ON url_mappings (expiration_at);
+
+-- Url hits count (one row per redirect, it used to keep a single row per url)
+CREATE TABLE IF NOT EXISTS urls_hit_count (
+    id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS Identity,
+    url_id INT NOT NULL,
+    hit_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (url_id) REFERENCES url_mappings(id) ON DELETE CASCADE
+);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'urls_hit_count' AND column_name = 'id'
+    ) THEN
+        ALTER TABLE urls_hit_count DROP CONSTRAINT IF EXISTS urls_hit_count_pkey;
+        ALTER TABLE urls_hit_count ADD COLUMN id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS Identity;
+        ALTER TABLE urls_hit_count ALTER COLUMN url_id SET NOT NULL;
+        -- Rebuilt on (url_id, hit_at) below.
+        DROP INDEX IF EXISTS urls_hit_count_url_id_idx;
+    END IF;
+END
+$$;
+
+ALTER TABLE urls_hit_count
+    ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS country VARCHAR(8),
+    ADD COLUMN IF NOT EXISTS referrer VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS device VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS urls_hit_count_url_id_idx ON urls_hit_count (url_id, hit_at);
+CREATE INDEX IF NOT EXISTS urls_hit_count_hit_at_idx ON urls_hit_count (hit_at);
+
+-- Url daily stats (rollups of urls_hit_count, days in UTC)
+CREATE TABLE IF NOT EXISTS url_daily_stats (
+    url_id INT NOT NULL,
+    day DATE NOT NULL,
+    hits INT NOT NULL DEFAULT 0,
+    bot_hits INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day),
+    FOREIGN KEY (url_id) REFERENCES url_mappings(id) ON DELETE CASCADE
+);
+
+-- The rollup resumes from the last day rolled up.
+CREATE INDEX IF NOT EXISTS url_daily_stats_day_idx ON url_daily_stats (day);
+
+-- Idempotency keys of the shorten requests, with the response to replay
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status INT,
+    response TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, idempotency_key),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- Incremental id generator
+-- An unlogged sequence is reset after a crash, and would lease the same ids again.
+ALTER SEQUENCE public.incr_id_generator_seq
+    SET LOGGED;
+
+-- Every nextval leases a block of 1000 ids to a replica, past the ids already handed out.
+-- Up to the 2^40 - 1 ids of the default SHORTCODE_ID_BITS (40), raise it along with the bits.
+ALTER SEQUENCE public.incr_id_generator_seq
+    AS BIGINT
+    INCREMENT BY 1000
+    MAXVALUE 1099511627775;
+
+COMMENT ON SEQUENCE public.incr_id_generator_seq
+    IS 'to lease the blocks of incremental ids for short urls';
+
+COMMIT;
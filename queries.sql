@@ -18,24 +18,154 @@ VALUES ($1,$2,$3,$4);
 SELECT original_url, expiration_at FROM url_mappings 
 WHERE short_url = $1 AND expiration_at > CURRENT_TIMESTAMP;
 
--- name: IncrUrlHitCountQuery
-UPDATE url_mappings
-SET hit_count = hit_count + 1
+-- name: GetShortUrlOwnerQuery
+SELECT user_id FROM url_mappings
 WHERE short_url = $1;
 
+-- name: GetUserShortUrlQuery
+SELECT short_url, expiration_at FROM url_mappings
+WHERE original_url = $1 AND user_id = $2 AND expiration_at > CURRENT_TIMESTAMP
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: IncrUrlHitCountQuery
+WITH hit AS (
+    UPDATE url_mappings
+    SET hit_count = hit_count + 1
+    WHERE short_url = $1
+    RETURNING id
+)
+INSERT INTO urls_hit_count (url_id, is_bot, country, referrer, device)
+SELECT id, FALSE, $2, $3, $4 FROM hit;
+
+-- name: IncrUrlBotHitCountQuery
+WITH hit AS (
+    UPDATE url_mappings
+    SET bot_hit_count = bot_hit_count + 1
+    WHERE short_url = $1
+    RETURNING id
+)
+INSERT INTO urls_hit_count (url_id, is_bot, country, referrer, device)
+SELECT id, TRUE, $2, $3, $4 FROM hit;
+
 -- name: GetIncrementalIDQuery
 select nextval('incr_id_generator_seq');
 
--- name: GetAllShortUrlAliasQuery
-SELECT DISTINCT short_url
-FROM url_mappings 
+-- name: GetIDBlockSizeQuery
+SELECT increment_by FROM pg_sequences
+WHERE schemaname = 'public' AND sequencename = 'incr_id_generator_seq';
+
+-- name: GetShortUrlAliasesSinceQuery
+SELECT id, COALESCE(short_url, reclaimed_short_url)
+FROM url_mappings
+WHERE id > $1 AND expiration_at > $2
+ORDER BY id;
+
+-- name: CountActiveShortUrlsQuery
+SELECT COUNT(*)
+FROM url_mappings
 WHERE expiration_at > CURRENT_TIMESTAMP;
 
--- name: MostActiveHitsQuery
-SELECT original_url, short_url
+-- name: ExpiredShortUrlAliasesQuery
+SELECT id, COALESCE(short_url, reclaimed_short_url), expiration_at
 FROM url_mappings
-WHERE expiration_at > CURRENT_TIMESTAMP AND hit_count > (
-    SELECT AVG(hit_count) FROM url_mappings
-    WHERE expiration_at > CURRENT_TIMESTAMP AND hit_count > 0
+WHERE expiration_at > $1 AND expiration_at <= $2 AND id <= $3;
+
+-- name: ReclaimExpiredShortUrlQuery
+UPDATE url_mappings
+SET reclaimed_short_url = short_url, short_url = NULL
+WHERE short_url = $1 AND expiration_at <= CURRENT_TIMESTAMP
+RETURNING id, expiration_at;
+
+-- name: RecentlyActiveUrlsQuery
+SELECT m.original_url, m.short_url, m.expiration_at
+FROM urls_hit_count c
+JOIN url_mappings m ON m.id = c.url_id
+WHERE c.hit_at > $1 AND c.is_bot = FALSE AND m.expiration_at > CURRENT_TIMESTAMP
+GROUP BY m.id
+ORDER BY COUNT(*) DESC
+LIMIT $2;
+
+-- name: TopLinksQuery
+SELECT m.short_url, m.original_url, m.hit_count,
+    COUNT(c.id) FILTER (WHERE c.hit_at > CURRENT_TIMESTAMP - $1::interval) AS window_hits,
+    COUNT(c.id) FILTER (WHERE c.hit_at <= CURRENT_TIMESTAMP - $1::interval) AS previous_window_hits
+FROM url_mappings m
+JOIN users u ON u.id = m.user_id
+JOIN urls_hit_count c ON c.url_id = m.id
+    AND c.is_bot = FALSE
+    AND c.hit_at > CURRENT_TIMESTAMP - 2 * $1::interval
+WHERE m.expiration_at > CURRENT_TIMESTAMP AND (
+    $2 = 'global'
+    OR ($2 = 'me' AND m.user_id = $3)
+    OR ($2 = 'workspace' AND $4 <> '' AND SPLIT_PART(LOWER(u.email), '@', 2) = $4)
 )
-ORDER BY hit_count DESC;
\ No newline at end of file
+GROUP BY m.id, m.short_url, m.original_url, m.hit_count
+HAVING COUNT(c.id) FILTER (WHERE c.hit_at > CURRENT_TIMESTAMP - $1::interval) > 0
+ORDER BY window_hits DESC, m.hit_count DESC
+LIMIT $5;
+
+-- name: RollupDailyUrlHitsQuery
+INSERT INTO url_daily_stats (url_id, day, hits, bot_hits)
+SELECT url_id, (hit_at AT TIME ZONE 'UTC')::date AS day,
+    COUNT(*) FILTER (WHERE NOT is_bot),
+    COUNT(*) FILTER (WHERE is_bot)
+FROM urls_hit_count
+WHERE hit_at >= ($1::date)::timestamp AT TIME ZONE 'UTC'
+    AND hit_at < ($2::date)::timestamp AT TIME ZONE 'UTC'
+GROUP BY url_id, day
+ON CONFLICT (url_id, day) DO UPDATE
+SET hits = EXCLUDED.hits, bot_hits = EXCLUDED.bot_hits;
+
+-- name: GetRollupWatermarkQuery
+SELECT MAX(day) FROM url_daily_stats;
+
+-- name: PurgeRawUrlHitsQuery
+DELETE FROM urls_hit_count
+WHERE hit_at < ($1::date)::timestamp AT TIME ZONE 'UTC';
+
+-- name: GetUrlDailyStatsQuery
+WITH link AS (
+    SELECT id FROM url_mappings WHERE short_url = $1
+), horizon AS (
+    SELECT COALESCE(MAX(s.day), '-infinity'::date) AS day
+    FROM url_daily_stats s, link
+    WHERE s.url_id = link.id
+)
+SELECT s.day, s.hits, s.bot_hits
+FROM url_daily_stats s, link
+WHERE s.url_id = link.id AND s.day >= $2::date
+UNION ALL
+SELECT (c.hit_at AT TIME ZONE 'UTC')::date AS day,
+    COUNT(*) FILTER (WHERE NOT c.is_bot),
+    COUNT(*) FILTER (WHERE c.is_bot)
+FROM urls_hit_count c, link, horizon
+WHERE c.url_id = link.id
+    AND (c.hit_at AT TIME ZONE 'UTC')::date > horizon.day
+    AND (c.hit_at AT TIME ZONE 'UTC')::date >= $2::date
+GROUP BY 1
+ORDER BY day;
+
+-- name: ClaimIdempotencyKeyQuery
+INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, idempotency_key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash, status = NULL, response = NULL, created_at = CURRENT_TIMESTAMP
+WHERE idempotency_keys.created_at < $4 OR (idempotency_keys.status IS NULL AND idempotency_keys.created_at < $5)
+RETURNING user_id;
+
+-- name: GetIdempotencyKeyQuery
+SELECT request_hash, status, response FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2;
+
+-- name: SaveIdempotentResponseQuery
+UPDATE idempotency_keys SET status = $3, response = $4
+WHERE user_id = $1 AND idempotency_key = $2;
+
+-- name: ReleaseIdempotencyKeyQuery
+DELETE FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2 AND status IS NULL;
+
+-- name: PurgeIdempotencyKeysQuery
+DELETE FROM idempotency_keys
+WHERE created_at < $1;